@@ -18,28 +18,43 @@ package pkg
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 	"text/tabwriter"
+	"time"
 
+	"github.com/ghodss/yaml"
 	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	"k8s.io/api/core/v1"
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/util/json"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	clientappsv1beta1 "k8s.io/client-go/kubernetes/typed/apps/v1beta1"
+	clientbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+	clientcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	clientextv1beta1 "k8s.io/client-go/kubernetes/typed/extensions/v1beta1"
 	"k8s.io/kubernetes/pkg/api"
 	apiv1 "k8s.io/kubernetes/pkg/api/v1"
 	"k8s.io/kubernetes/pkg/apis/apps"
+	"k8s.io/kubernetes/pkg/apis/batch"
 	"k8s.io/kubernetes/pkg/apis/extensions"
+	"k8s.io/kubernetes/pkg/controller/daemon"
 	deploymentutil "k8s.io/kubernetes/pkg/controller/deployment/util"
+	"k8s.io/kubernetes/pkg/controller/statefulset"
 	sliceutil "k8s.io/kubectl/pkg/util/slice"
 	printersinternal "k8s.io/kubernetes/pkg/printers/internalversion"
 )
@@ -48,107 +63,974 @@ const (
 	ChangeCauseAnnotation = "kubernetes.io/change-cause"
 )
 
+// ChangeCauseAnnotationKey is the annotation the change-cause of a revision is read from, and the one
+// rollbacks record their change-cause in. Revisions without it fall back to the standard ChangeCauseAnnotation.
+var ChangeCauseAnnotationKey = ChangeCauseAnnotation
+
 // HistoryViewer provides an interface for resources have historical information.
 type HistoryViewer interface {
 	ViewHistory(namespace, name string, revision int64) (string, error)
 }
 
+// AllNamespacesHistoryViewer is implemented by history viewers that can show the history of
+// the objects with a given name in every namespace at once.
+type AllNamespacesHistoryViewer interface {
+	ViewHistoryAllNamespaces(name string, revision int64) (string, error)
+}
+
+// HistoryOptions holds the optional settings shared by all history viewers.
+type HistoryOptions struct {
+	// OutputFormat selects how the history is rendered. The empty string keeps the
+	// human-readable output, "json" and "yaml" emit a structured document instead.
+	OutputFormat string
+	// ChangeCauseFilter restricts the revision overview to the revisions whose change-cause
+	// contains it, ignoring case. The empty string lists every revision.
+	ChangeCauseFilter string
+	// Descending lists the newest revision first instead of last.
+	Descending bool
+	// Offset skips the given number of revisions at the start of the revision overview, after
+	// sorting and filtering. Offsets past the last revision list no revisions.
+	Offset int
+	// Limit lists at most the given number of revisions in the revision overview, after
+	// skipping Offset revisions. Zero lists every remaining revision.
+	Limit int
+	// TemplatePrinter renders the details of a single revision in human-readable form.
+	// Defaults to DescribeTemplatePrinter.
+	TemplatePrinter TemplatePrinter
+	// ShowImages adds an IMAGES column listing the container images of each revision to
+	// the human-readable Deployment revision overview.
+	ShowImages bool
+	// ShowRawPatch adds the raw patch stored in the ControllerRevision of a single DaemonSet
+	// or StatefulSet revision to its human-readable details.
+	ShowRawPatch bool
+	// ColumnPadding is the number of spaces between the columns of the human-readable revision
+	// overview. Nil means the default of 2.
+	ColumnPadding *int
+	// ColumnMinWidth is the minimal width of each column of the human-readable revision overview,
+	// including its padding.
+	ColumnMinWidth int
+}
+
+// tabbedString renders the tab separated columns written by f as laid out by ColumnPadding and ColumnMinWidth.
+func (o HistoryOptions) tabbedString(f func(io.Writer) error) (string, error) {
+	opts := tabbedOptions{MinWidth: o.ColumnMinWidth, Padding: defaultTabbedOptions.Padding}
+	if o.ColumnPadding != nil {
+		opts.Padding = *o.ColumnPadding
+	}
+	return tabbedStringWithOptions(f, opts)
+}
+
+// templatePrinter returns the configured TemplatePrinter, or the default one if none is set.
+func (o HistoryOptions) templatePrinter() TemplatePrinter {
+	if o.TemplatePrinter == nil {
+		return DescribeTemplatePrinter{}
+	}
+	return o.TemplatePrinter
+}
+
+// withRawPatch appends the pretty-printed patch data of history to the details of its revision
+// in content, if ShowRawPatch is set.
+func (o HistoryOptions) withRawPatch(content string, history *appsv1beta1.ControllerRevision) (string, error) {
+	if !o.ShowRawPatch {
+		return content, nil
+	}
+	data := &bytes.Buffer{}
+	if err := json.Indent(data, history.Data.Raw, "", "    "); err != nil {
+		return "", fmt.Errorf("unable to parse history %s", history.Name)
+	}
+	return fmt.Sprintf("%s\nRevision Data:\n%s\n", content, data.String()), nil
+}
+
+// selectRevisions returns the revisions of the revision overview: those with a change-cause matching the
+// ChangeCauseFilter, sorted, and then selected by Offset and Limit. revisions itself is not modified.
+func (o HistoryOptions) selectRevisions(revisions []RevisionInfo) []RevisionInfo {
+	selected := make([]RevisionInfo, 0, len(revisions))
+	for _, r := range revisions {
+		if strings.Contains(strings.ToLower(r.ChangeCause), strings.ToLower(o.ChangeCauseFilter)) {
+			selected = append(selected, r)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		if o.Descending {
+			return selected[i].Revision > selected[j].Revision
+		}
+		return selected[i].Revision < selected[j].Revision
+	})
+	start, end := o.revisionRange(len(selected))
+	return selected[start:end]
+}
+
+// revisionRange returns the start and end index of the revisions selected by Offset and Limit out of
+// count sorted revisions, clamped to count.
+func (o HistoryOptions) revisionRange(count int) (int, int) {
+	start := o.Offset
+	if start < 0 {
+		start = 0
+	}
+	if start > count {
+		start = count
+	}
+	end := count
+	if o.Limit > 0 && o.Limit < end-start {
+		end = start + o.Limit
+	}
+	return start, end
+}
+
+// noMatchingHistory returns the message printed when no revision matches the ChangeCauseFilter, or
+// when Offset skips every revision.
+func (o HistoryOptions) noMatchingHistory() string {
+	if len(o.ChangeCauseFilter) == 0 {
+		return "No rollout history found."
+	}
+	return fmt.Sprintf("No rollout history matching %s.", o.ChangeCauseFilter)
+}
+
 func HistoryViewerFor(kind schema.GroupKind, c kubernetes.Interface) (HistoryViewer, error) {
+	return HistoryViewerWithOptions(kind, c, HistoryOptions{})
+}
+
+// HistoryViewerForObject returns a HistoryViewer for the kind of obj.
+func HistoryViewerForObject(obj runtime.Object, c kubernetes.Interface) (HistoryViewer, error) {
+	kind, err := objectGroupKind(obj)
+	if err != nil {
+		return nil, err
+	}
+	return HistoryViewerFor(kind, c)
+}
+
+// objectGroupKind returns the GroupKind of obj, which must be one of the internal or external
+// Deployment, DaemonSet, StatefulSet or ReplicationController types.
+func objectGroupKind(obj runtime.Object) (schema.GroupKind, error) {
+	switch obj.(type) {
+	case *extensions.Deployment, *extensionsv1beta1.Deployment:
+		return extensions.Kind("Deployment"), nil
+	case *appsv1beta1.Deployment:
+		return apps.Kind("Deployment"), nil
+	case *extensions.DaemonSet, *extensionsv1beta1.DaemonSet:
+		return extensions.Kind("DaemonSet"), nil
+	case *apps.StatefulSet, *appsv1beta1.StatefulSet:
+		return apps.Kind("StatefulSet"), nil
+	case *api.ReplicationController, *v1.ReplicationController:
+		return api.Kind("ReplicationController"), nil
+	case *batch.CronJob, *batchv1beta1.CronJob:
+		return batch.Kind("CronJob"), nil
+	}
+	return schema.GroupKind{}, fmt.Errorf("unable to determine the kind of %T", obj)
+}
+
+// HistoryViewerWithOptions returns a HistoryViewer for the given kind configured with opts.
+func HistoryViewerWithOptions(kind schema.GroupKind, c kubernetes.Interface, opts HistoryOptions) (HistoryViewer, error) {
+	if err := validateOutputFormat(opts.OutputFormat); err != nil {
+		return nil, err
+	}
 	switch kind {
 	case extensions.Kind("Deployment"), apps.Kind("Deployment"):
-		return &DeploymentHistoryViewer{c}, nil
+		return &DeploymentHistoryViewer{c: c, HistoryOptions: opts}, nil
 	case apps.Kind("StatefulSet"):
-		return &StatefulSetHistoryViewer{c}, nil
+		return &StatefulSetHistoryViewer{c: c, HistoryOptions: opts}, nil
 	case extensions.Kind("DaemonSet"), apps.Kind("DaemonSet"):
-		return &DaemonSetHistoryViewer{c}, nil
+		return &DaemonSetHistoryViewer{c: c, HistoryOptions: opts}, nil
+	case api.Kind("ReplicationController"):
+		return &ReplicationControllerHistoryViewer{c: c, HistoryOptions: opts}, nil
+	case batch.Kind("CronJob"):
+		return &CronJobHistoryViewer{c: c, HistoryOptions: opts}, nil
 	}
-	return nil, fmt.Errorf("no history viewer has been implemented for %q", kind)
+	return nil, &UnsupportedKindError{Kind: kind, Operation: "history viewer"}
+}
+
+// revisionSummary is the structured form of a single revision.
+type revisionSummary struct {
+	Revision          int64       `json:"revision"`
+	Name              string      `json:"name,omitempty"`
+	ChangeCause       string      `json:"changeCause,omitempty"`
+	CreationTimestamp metav1.Time `json:"creationTimestamp"`
+	Images            []string    `json:"images,omitempty"`
+	// Collision is set when more than one ControllerRevision shares this revision number.
+	Collision bool `json:"collision,omitempty"`
+	// Current is set for the revision the live object is running.
+	Current bool `json:"current,omitempty"`
+}
+
+// formatRevision returns the revision of r followed by marker as shown in the REVISION column, noting if r
+// is the current revision.
+func formatRevision(r RevisionInfo, marker string) string {
+	if r.IsCurrent {
+		return fmt.Sprintf("%d%s (current)", r.Revision, marker)
+	}
+	return fmt.Sprintf("%d%s", r.Revision, marker)
+}
+
+// newRevisionSummary returns the structured form of r, running the pod template template.
+func newRevisionSummary(r RevisionInfo, template *v1.PodTemplateSpec) revisionSummary {
+	return revisionSummary{
+		Revision:          r.Revision,
+		Name:              r.Name,
+		ChangeCause:       r.ChangeCause,
+		CreationTimestamp: r.CreationTime,
+		Images:            containerImages(template),
+		Current:           r.IsCurrent,
+	}
+}
+
+// historySummary is the document emitted by ViewHistory for structured output formats.
+type historySummary struct {
+	// Namespace is only set when viewing history across all namespaces.
+	Namespace string            `json:"namespace,omitempty"`
+	Revisions []revisionSummary `json:"revisions"`
 }
 
 type DeploymentHistoryViewer struct {
 	c kubernetes.Interface
+	HistoryOptions
 }
 
 // ViewHistory returns a revision-to-replicaset map as the revision history of a deployment
 // TODO: this should be a describer
 func (h *DeploymentHistoryViewer) ViewHistory(namespace, name string, revision int64) (string, error) {
 	versionedExtensionsClient := h.c.ExtensionsV1beta1()
-	deployment, err := versionedExtensionsClient.Deployments(namespace).Get(name, metav1.GetOptions{})
+	var deployment *extensionsv1beta1.Deployment
+	err := retryOnTransientError(func() (err error) {
+		deployment, err = versionedExtensionsClient.Deployments(namespace).Get(name, metav1.GetOptions{})
+		return err
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to retrieve deployment %s: %v", name, err)
 	}
-	_, allOldRSs, newRS, err := deploymentutil.GetAllReplicaSets(deployment, versionedExtensionsClient)
+	revisionToRS, err := deploymentRevisions(deployment, versionedExtensionsClient)
+	if err != nil {
+		return "", err
+	}
+	revisions := deploymentRevisionInfos(deployment, revisionToRS)
+	if len(revisions) == 0 {
+		return "No rollout history found.", nil
+	}
+
+	if revision > 0 {
+		// Print details of a specific revision
+		rs, ok := revisionToRS[revision]
+		if !ok {
+			return "", revisionNotFound(revision, revisionNumbers(revisions))
+		}
+		// Copy the template, the change-cause is added to its annotations
+		template := rs.Spec.Template.DeepCopy()
+		if template.Annotations == nil {
+			template.Annotations = make(map[string]string)
+		}
+		if changeCause := getChangeCause(rs); len(changeCause) > 0 {
+			template.Annotations[ChangeCauseAnnotation] = changeCause
+		}
+		if len(h.OutputFormat) > 0 {
+			return printStructured(template, h.OutputFormat)
+		}
+		return h.templatePrinter().PrintTemplate(template)
+	}
+
+	revisions = h.selectRevisions(revisions)
+	if len(h.OutputFormat) > 0 {
+		summary := historySummary{Revisions: []revisionSummary{}}
+		for _, r := range revisions {
+			summary.Revisions = append(summary.Revisions, newRevisionSummary(r, &revisionToRS[r.Revision].Spec.Template))
+		}
+		return printStructured(summary, h.OutputFormat)
+	}
+	if len(revisions) == 0 {
+		return h.noMatchingHistory(), nil
+	}
+
+	return h.tabbedString(func(out io.Writer) error {
+		if h.ShowImages {
+			fmt.Fprintf(out, "REVISION\tNAME\tCREATED\tCHANGE-CAUSE\tIMAGES\n")
+		} else {
+			fmt.Fprintf(out, "REVISION\tNAME\tCREATED\tCHANGE-CAUSE\n")
+		}
+		for _, r := range revisions {
+			changeCause := r.ChangeCause
+			if len(changeCause) == 0 {
+				changeCause = "<none>"
+			}
+			if h.ShowImages {
+				fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\n", formatRevision(r, ""), r.Name, formatCreationTimestamp(r.CreationTime), changeCause, containerImagePairs(&revisionToRS[r.Revision].Spec.Template))
+				continue
+			}
+			fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", formatRevision(r, ""), r.Name, formatCreationTimestamp(r.CreationTime), changeCause)
+		}
+		return nil
+	})
+}
+
+// deploymentRevisions returns all ReplicaSets of the given deployment keyed by their revision.
+func deploymentRevisions(deployment *extensionsv1beta1.Deployment, c clientextv1beta1.ExtensionsV1beta1Interface) (map[int64]*extensionsv1beta1.ReplicaSet, error) {
+	var allOldRSs []*extensionsv1beta1.ReplicaSet
+	var newRS *extensionsv1beta1.ReplicaSet
+	err := retryOnTransientError(func() (err error) {
+		_, allOldRSs, newRS, err = deploymentutil.GetAllReplicaSets(deployment, c)
+		return err
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to retrieve replica sets from deployment %s: %v", name, err)
+		return nil, fmt.Errorf("failed to retrieve replica sets from deployment %s: %v", deployment.Name, err)
 	}
 	allRSs := allOldRSs
 	if newRS != nil {
 		allRSs = append(allRSs, newRS)
 	}
 
-	historyInfo := make(map[int64]*v1.PodTemplateSpec)
+	revisionToRS := make(map[int64]*extensionsv1beta1.ReplicaSet)
 	for _, rs := range allRSs {
 		v, err := deploymentutil.Revision(rs)
 		if err != nil {
 			continue
 		}
-		historyInfo[v] = &rs.Spec.Template
-		changeCause := getChangeCause(rs)
-		if historyInfo[v].Annotations == nil {
-			historyInfo[v].Annotations = make(map[string]string)
+		revisionToRS[v] = rs
+	}
+	return revisionToRS, nil
+}
+
+// deploymentRevisionTemplate returns the given revision and its pod template from a revision-to-replicaset map.
+// If toRevision is 0, the last previously used revision and its template are returned.
+func deploymentRevisionTemplate(revisionToRS map[int64]*extensionsv1beta1.ReplicaSet, toRevision int64) (int64, *v1.PodTemplateSpec, error) {
+	// Sort the revisionToRS map by revision
+	revisions := make([]int64, 0, len(revisionToRS))
+	for r := range revisionToRS {
+		revisions = append(revisions, r)
+	}
+	sliceutil.SortInts64(revisions)
+
+	if toRevision > 0 {
+		rs, ok := revisionToRS[toRevision]
+		if !ok {
+			// The ReplicaSet of the revision may have been pruned by the revision history limit
+			return 0, nil, revisionNotFound(toRevision, revisions)
 		}
-		if len(changeCause) > 0 {
-			historyInfo[v].Annotations[ChangeCauseAnnotation] = changeCause
+		return toRevision, &rs.Spec.Template, nil
+	}
+	if len(revisionToRS) < 2 {
+		return 0, nil, &NoHistoryError{}
+	}
+
+	// Find the latest revision (2nd max)
+	revision := revisions[len(revisions)-2]
+	return revision, &revisionToRS[revision].Spec.Template, nil
+}
+
+// revisionNotFound returns a RevisionNotFoundError for revision, listing the revisions available instead
+// once each in ascending order. A nil available means the revisions are not known. available itself is
+// not modified.
+func revisionNotFound(revision int64, available []int64) error {
+	if available == nil {
+		return &RevisionNotFoundError{Revision: revision}
+	}
+	sorted := make([]int64, 0, len(available))
+	seen := make(map[int64]bool, len(available))
+	for _, r := range available {
+		// Revisions shared by more than one ControllerRevision after a hash collision are listed once
+		if !seen[r] {
+			seen[r] = true
+			sorted = append(sorted, r)
 		}
 	}
+	sliceutil.SortInts64(sorted)
+	return &RevisionNotFoundError{Revision: revision, Available: sorted}
+}
 
-	if len(historyInfo) == 0 {
+// historyRevisionNumbers returns the revision of each of history.
+func historyRevisionNumbers(history []*appsv1beta1.ControllerRevision) []int64 {
+	revisions := make([]int64, 0, len(history))
+	for _, h := range history {
+		revisions = append(revisions, h.Revision)
+	}
+	return revisions
+}
+
+// formatRevisions returns revisions as a comma separated list, or "<none>" if there are none.
+func formatRevisions(revisions []int64) string {
+	if len(revisions) == 0 {
+		return "<none>"
+	}
+	formatted := make([]string, 0, len(revisions))
+	for _, r := range revisions {
+		formatted = append(formatted, fmt.Sprintf("%d", r))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// GetRevisionTemplate returns the pod template of a specific revision of the Deployment, DaemonSet
+// or StatefulSet named name in namespace. If revision is 0, the template of the last previously
+// used revision is returned. The template is a copy, without the pod-template-hash label the
+// deployment controller adds to the templates of ReplicaSets.
+func GetRevisionTemplate(kind schema.GroupKind, c kubernetes.Interface, namespace, name string, revision int64) (*v1.PodTemplateSpec, error) {
+	if revision < 0 {
+		return nil, revisionNotFound(revision, nil)
+	}
+	h, err := getLiveHistory(kind, c, namespace, name, "revision template getter")
+	if err != nil {
+		return nil, err
+	}
+	return h.template(revision)
+}
+
+// MatchesRevision returns whether the live Deployment, DaemonSet or StatefulSet named name in namespace
+// is already at the given revision, that is whether it is its current revision as CurrentRevision
+// determines it. Nothing is changed.
+func MatchesRevision(kind schema.GroupKind, c kubernetes.Interface, namespace, name string, revision int64) (bool, error) {
+	if revision <= 0 {
+		return false, revisionNotFound(revision, nil)
+	}
+	h, err := getLiveHistory(kind, c, namespace, name, "revision matcher")
+	if err != nil {
+		return false, err
+	}
+	if _, err := h.template(revision); err != nil {
+		return false, err
+	}
+	current, err := h.current()
+	if err != nil {
+		return false, err
+	}
+	return current == revision, nil
+}
+
+// CurrentRevision returns the revision number of the live Deployment, DaemonSet or StatefulSet named name in
+// namespace. For a Deployment this is the revision of its new ReplicaSet, for a DaemonSet or StatefulSet it is
+// the revision of the ControllerRevision matching its current template.
+func CurrentRevision(kind schema.GroupKind, c kubernetes.Interface, namespace, name string) (int64, error) {
+	h, err := getLiveHistory(kind, c, namespace, name, "current revision getter")
+	if err != nil {
+		return 0, err
+	}
+	current, err := h.current()
+	if err != nil {
+		return 0, err
+	}
+	if current < 0 {
+		if h.deployment != nil {
+			return 0, fmt.Errorf("no replica set matches the current template of deployment %s", name)
+		}
+		return 0, fmt.Errorf("no revision matches the current template of %s %s", kind.Kind, name)
+	}
+	return current, nil
+}
+
+// liveHistory is a live Deployment, DaemonSet or StatefulSet together with the objects recording its revisions.
+type liveHistory struct {
+	// kind names the object in a NoHistoryError.
+	kind string
+	name string
+	// deployment and revisionToRS are set for Deployments.
+	deployment   *extensionsv1beta1.Deployment
+	revisionToRS map[int64]*extensionsv1beta1.ReplicaSet
+	// history is set for DaemonSets and StatefulSets. match returns whether the live object runs a
+	// history, and apply returns the pod template the live object has at a history.
+	history []*appsv1beta1.ControllerRevision
+	match   func(*appsv1beta1.ControllerRevision) (bool, error)
+	apply   func(*appsv1beta1.ControllerRevision) (*v1.PodTemplateSpec, error)
+}
+
+// getLiveHistory retrieves the Deployment, DaemonSet or StatefulSet named name in namespace and its revisions.
+// operation describes the caller in the error returned for other kinds.
+func getLiveHistory(kind schema.GroupKind, c kubernetes.Interface, namespace, name, operation string) (*liveHistory, error) {
+	switch kind {
+	case extensions.Kind("Deployment"), apps.Kind("Deployment"):
+		var deployment *extensionsv1beta1.Deployment
+		err := retryOnTransientError(func() (err error) {
+			deployment, err = c.ExtensionsV1beta1().Deployments(namespace).Get(name, metav1.GetOptions{})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve deployment %s: %v", name, err)
+		}
+		revisionToRS, err := deploymentRevisions(deployment, c.ExtensionsV1beta1())
+		if err != nil {
+			return nil, err
+		}
+		return &liveHistory{kind: "deployment", name: name, deployment: deployment, revisionToRS: revisionToRS}, nil
+	case extensions.Kind("DaemonSet"), apps.Kind("DaemonSet"):
+		ds, history, err := daemonSetHistory(c.ExtensionsV1beta1(), c.AppsV1beta1(), namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		return &liveHistory{
+			kind:    "DaemonSet",
+			name:    name,
+			history: history,
+			match:   func(h *appsv1beta1.ControllerRevision) (bool, error) { return daemon.Match(ds, h) },
+			apply: func(h *appsv1beta1.ControllerRevision) (*v1.PodTemplateSpec, error) {
+				dsOfHistory, err := applyDaemonSetHistory(ds, h)
+				if err != nil {
+					return nil, err
+				}
+				return &dsOfHistory.Spec.Template, nil
+			},
+		}, nil
+	case apps.Kind("StatefulSet"):
+		sts, history, err := statefulSetHistory(c.AppsV1beta1(), namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		return &liveHistory{
+			kind:    "StatefulSet",
+			name:    name,
+			history: history,
+			match:   func(h *appsv1beta1.ControllerRevision) (bool, error) { return statefulset.Match(sts, h) },
+			apply: func(h *appsv1beta1.ControllerRevision) (*v1.PodTemplateSpec, error) {
+				stsOfHistory, err := statefulset.ApplyRevision(sts, h)
+				if err != nil {
+					return nil, err
+				}
+				return &stsOfHistory.Spec.Template, nil
+			},
+		}, nil
+	}
+	return nil, &UnsupportedKindError{Kind: kind, Operation: operation}
+}
+
+// template returns the pod template of the given revision, or of the last previously used revision if
+// revision is 0. Deployment templates are copied, without their pod-template-hash label.
+func (h *liveHistory) template(revision int64) (*v1.PodTemplateSpec, error) {
+	if h.deployment != nil {
+		if revision == 0 && len(h.revisionToRS) < 2 {
+			return nil, &NoHistoryError{Kind: h.kind, Name: h.name}
+		}
+		_, template, err := deploymentRevisionTemplate(h.revisionToRS, revision)
+		if err != nil {
+			return nil, err
+		}
+		template = template.DeepCopy()
+		delete(template.Labels, extensionsv1beta1.DefaultDeploymentUniqueLabelKey)
+		return template, nil
+	}
+	if revision == 0 && len(h.history) < 2 {
+		return nil, &NoHistoryError{Kind: h.kind, Name: h.name}
+	}
+	toHistory := FindHistory(revision, h.history)
+	if toHistory == nil {
+		return nil, revisionNotFound(revision, historyRevisionNumbers(h.history))
+	}
+	template, err := h.apply(toHistory)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse history %s", toHistory.Name)
+	}
+	return template, nil
+}
+
+// current returns the current revision, or -1 if the live object matches none of its revisions.
+func (h *liveHistory) current() (int64, error) {
+	if h.deployment != nil {
+		return deploymentCurrentRevision(h.deployment, h.revisionToRS), nil
+	}
+	return matchingRevision(h.history, h.match)
+}
+
+// revisions returns a RevisionInfo for each revision.
+func (h *liveHistory) revisions() ([]RevisionInfo, error) {
+	if h.deployment != nil {
+		return deploymentRevisionInfos(h.deployment, h.revisionToRS), nil
+	}
+	return historyRevisions(h.history, h.match)
+}
+
+// matchingRevision returns the revision of the current history as currentHistory finds it, or -1 if there is none.
+func matchingRevision(history []*appsv1beta1.ControllerRevision, match func(*appsv1beta1.ControllerRevision) (bool, error)) (int64, error) {
+	current, err := currentHistory(history, match)
+	if err != nil || current == nil {
+		return -1, err
+	}
+	return current.Revision, nil
+}
+
+// currentHistory returns the history with the highest revision for which match returns true, or nil if there is
+// none. More than one revision may match after a rollback to a template that was seen before, the one with the
+// highest revision is current. Of the histories sharing that revision after a hash collision, the first one wins.
+func currentHistory(history []*appsv1beta1.ControllerRevision, match func(*appsv1beta1.ControllerRevision) (bool, error)) (*appsv1beta1.ControllerRevision, error) {
+	var current *appsv1beta1.ControllerRevision
+	for _, h := range history {
+		matches, err := match(h)
+		if err != nil {
+			return nil, err
+		}
+		if matches && (current == nil || h.Revision > current.Revision) {
+			current = h
+		}
+	}
+	return current, nil
+}
+
+// deploymentCurrentRevision returns the revision of the new ReplicaSet of deployment, the one with the
+// highest revision whose template matches the deployment, or -1 if there is none.
+func deploymentCurrentRevision(deployment *extensionsv1beta1.Deployment, revisionToRS map[int64]*extensionsv1beta1.ReplicaSet) int64 {
+	current := int64(-1)
+	for r, rs := range revisionToRS {
+		if r > current && deploymentutil.EqualIgnoreHash(&rs.Spec.Template, &deployment.Spec.Template) {
+			current = r
+		}
+	}
+	return current
+}
+
+// RevisionInfo describes a single revision of a Deployment, DaemonSet, StatefulSet or ReplicationController.
+type RevisionInfo struct {
+	Revision int64
+	// Name is the name of the ReplicaSet, ControllerRevision or ReplicationController recording the revision.
+	Name         string
+	ChangeCause  string
+	CreationTime metav1.Time
+	// IsCurrent is true for the revision matching the current template of the live object.
+	IsCurrent bool
+}
+
+// ListRevisions returns the revisions of the Deployment, DaemonSet, StatefulSet or ReplicationController named
+// name in namespace, sorted by ascending revision.
+func ListRevisions(kind schema.GroupKind, c kubernetes.Interface, namespace, name string) ([]RevisionInfo, error) {
+	var revisions []RevisionInfo
+	if kind == api.Kind("ReplicationController") {
+		rc, revisionToRC, err := replicationControllerRevisions(c.CoreV1(), namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		revisions = replicationControllerRevisionInfos(rc, revisionToRC)
+	} else {
+		h, err := getLiveHistory(kind, c, namespace, name, "revision lister")
+		if err != nil {
+			return nil, err
+		}
+		revisions, err = h.revisions()
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+	return revisions, nil
+}
+
+// deploymentRevisionInfos returns a RevisionInfo for each ReplicaSet of revisionToRS, in no particular order.
+// The current one is the revision of the new ReplicaSet of deployment.
+func deploymentRevisionInfos(deployment *extensionsv1beta1.Deployment, revisionToRS map[int64]*extensionsv1beta1.ReplicaSet) []RevisionInfo {
+	current := deploymentCurrentRevision(deployment, revisionToRS)
+	revisions := make([]RevisionInfo, 0, len(revisionToRS))
+	for r, rs := range revisionToRS {
+		revisions = append(revisions, RevisionInfo{
+			Revision:     r,
+			Name:         rs.Name,
+			ChangeCause:  getChangeCause(rs),
+			CreationTime: rs.CreationTimestamp,
+			IsCurrent:    r == current,
+		})
+	}
+	return revisions
+}
+
+// replicationControllerRevisionInfos returns a RevisionInfo for each replication controller of revisionToRC,
+// in no particular order. The current one is rc itself.
+func replicationControllerRevisionInfos(rc *v1.ReplicationController, revisionToRC map[int64]*v1.ReplicationController) []RevisionInfo {
+	revisions := make([]RevisionInfo, 0, len(revisionToRC))
+	for r, revisionRC := range revisionToRC {
+		revisions = append(revisions, RevisionInfo{
+			Revision:     r,
+			Name:         revisionRC.Name,
+			ChangeCause:  getChangeCause(revisionRC),
+			CreationTime: revisionRC.CreationTimestamp,
+			IsCurrent:    revisionRC.Name == rc.Name,
+		})
+	}
+	return revisions
+}
+
+// revisionNumbers returns the revision of each of revisions.
+func revisionNumbers(revisions []RevisionInfo) []int64 {
+	numbers := make([]int64, 0, len(revisions))
+	for _, r := range revisions {
+		numbers = append(numbers, r.Revision)
+	}
+	return numbers
+}
+
+// historyRevisions returns a RevisionInfo for each of history, in the same order. The current one is the
+// history currentHistory finds.
+func historyRevisions(history []*appsv1beta1.ControllerRevision, match func(*appsv1beta1.ControllerRevision) (bool, error)) ([]RevisionInfo, error) {
+	current, err := currentHistory(history, match)
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]RevisionInfo, 0, len(history))
+	for _, h := range history {
+		revisions = append(revisions, RevisionInfo{
+			Revision:     h.Revision,
+			Name:         h.Name,
+			ChangeCause:  getChangeCause(h),
+			CreationTime: h.CreationTimestamp,
+			IsCurrent:    h == current,
+		})
+	}
+	return revisions, nil
+}
+
+// TemplatePrinter renders a pod template in human-readable form.
+type TemplatePrinter interface {
+	PrintTemplate(template *v1.PodTemplateSpec) (string, error)
+}
+
+// DescribeTemplatePrinter is the default TemplatePrinter, it renders pod templates the same way
+// "kubectl describe" does.
+type DescribeTemplatePrinter struct{}
+
+// PrintTemplate implements TemplatePrinter.
+func (DescribeTemplatePrinter) PrintTemplate(template *v1.PodTemplateSpec) (string, error) {
+	buf := bytes.NewBuffer([]byte{})
+	internalTemplate := &api.PodTemplateSpec{}
+	if err := apiv1.Convert_v1_PodTemplateSpec_To_api_PodTemplateSpec(template, internalTemplate, nil); err != nil {
+		return "", fmt.Errorf("failed to convert podtemplate, %v", err)
+	}
+	w := printersinternal.NewPrefixWriter(buf)
+	printersinternal.DescribePodTemplate(internalTemplate, w)
+	return buf.String(), nil
+}
+
+// printStructured serializes obj in the given output format, which must be either "json" or "yaml".
+func printStructured(obj interface{}, format string) (string, error) {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(obj, "", "    ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	case "yaml":
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return "", fmt.Errorf("unsupported output format %q, expected one of: json|yaml", format)
+}
+
+// validateOutputFormat returns an error if format is not a supported structured output format.
+// The empty string selects the default human-readable output and is always valid.
+func validateOutputFormat(format string) error {
+	switch format {
+	case "", "json", "yaml":
+		return nil
+	}
+	return fmt.Errorf("unsupported output format %q, expected one of: json|yaml", format)
+}
+
+// formatCreationTimestamp returns t in RFC 3339 form for the CREATED column of history tables.
+func formatCreationTimestamp(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// containerImages returns the images of all containers in the given pod template, in order.
+func containerImages(template *v1.PodTemplateSpec) []string {
+	var images []string
+	for _, c := range template.Spec.Containers {
+		images = append(images, c.Image)
+	}
+	return images
+}
+
+// containerImagePairs returns the containers of the given pod template as comma separated
+// name=image pairs, in order.
+func containerImagePairs(template *v1.PodTemplateSpec) string {
+	pairs := make([]string, 0, len(template.Spec.Containers))
+	for _, c := range template.Spec.Containers {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", c.Name, c.Image))
+	}
+	return strings.Join(pairs, ",")
+}
+
+type ReplicationControllerHistoryViewer struct {
+	c kubernetes.Interface
+	HistoryOptions
+}
+
+// ViewHistory returns the revision history of a replication controller, made of the replication
+// controllers sharing its labels that carry a revision annotation
+func (h *ReplicationControllerHistoryViewer) ViewHistory(namespace, name string, revision int64) (string, error) {
+	rc, revisionToRC, err := replicationControllerRevisions(h.c.CoreV1(), namespace, name)
+	if err != nil {
+		return "", err
+	}
+	revisions := replicationControllerRevisionInfos(rc, revisionToRC)
+	if len(revisions) == 0 {
 		return "No rollout history found.", nil
 	}
 
 	if revision > 0 {
 		// Print details of a specific revision
-		template, ok := historyInfo[revision]
+		rc, ok := revisionToRC[revision]
 		if !ok {
-			return "", fmt.Errorf("unable to find the specified revision")
+			return "", revisionNotFound(revision, revisionNumbers(revisions))
+		}
+		if len(h.OutputFormat) > 0 {
+			return printStructured(rc.Spec.Template, h.OutputFormat)
 		}
-		return printTemplate(template)
+		return h.templatePrinter().PrintTemplate(rc.Spec.Template)
 	}
 
-	// Sort the revisionToChangeCause map by revision
-	revisions := make([]int64, 0, len(historyInfo))
-	for r := range historyInfo {
-		revisions = append(revisions, r)
+	revisions = h.selectRevisions(revisions)
+	if len(h.OutputFormat) > 0 {
+		summary := historySummary{Revisions: []revisionSummary{}}
+		for _, r := range revisions {
+			summary.Revisions = append(summary.Revisions, newRevisionSummary(r, revisionToRC[r.Revision].Spec.Template))
+		}
+		return printStructured(summary, h.OutputFormat)
+	}
+	if len(revisions) == 0 {
+		return h.noMatchingHistory(), nil
+	}
+
+	return h.tabbedString(func(out io.Writer) error {
+		fmt.Fprintf(out, "REVISION\tNAME\tCREATED\tCHANGE-CAUSE\n")
+		for _, r := range revisions {
+			changeCause := r.ChangeCause
+			if len(changeCause) == 0 {
+				changeCause = "<none>"
+			}
+			fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", formatRevision(r, ""), r.Name, formatCreationTimestamp(r.CreationTime), changeCause)
+		}
+		return nil
+	})
+}
+
+// replicationControllerRevisions returns the replication controller named name in namespace, and all replication
+// controllers in namespace labeled with its labels keyed by the revision in their revision annotation. Replication
+// controllers without a revision annotation or a pod template are not part of the history.
+func replicationControllerRevisions(
+	core clientcorev1.CoreV1Interface,
+	namespace, name string) (*v1.ReplicationController, map[int64]*v1.ReplicationController, error) {
+	var rc *v1.ReplicationController
+	err := retryOnTransientError(func() (err error) {
+		rc, err = core.ReplicationControllers(namespace).Get(name, metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve ReplicationController %s: %v", name, err)
+	}
+	rcs := []v1.ReplicationController{*rc}
+	if len(rc.Labels) > 0 {
+		var rcList *v1.ReplicationControllerList
+		err := retryOnTransientError(func() (err error) {
+			rcList, err = core.ReplicationControllers(namespace).List(metav1.ListOptions{LabelSelector: labels.SelectorFromSet(rc.Labels).String()})
+			return err
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to find history of ReplicationController %s: %v", name, err)
+		}
+		rcs = rcList.Items
+	}
+
+	revisionToRC := make(map[int64]*v1.ReplicationController)
+	for i := range rcs {
+		v, err := deploymentutil.Revision(&rcs[i])
+		if err != nil || rcs[i].Spec.Template == nil {
+			continue
+		}
+		revisionToRC[v] = &rcs[i]
+	}
+	return rc, revisionToRC, nil
+}
+
+type CronJobHistoryViewer struct {
+	c kubernetes.Interface
+	HistoryOptions
+}
+
+// ViewHistory returns the revision history of a CronJob. The revision and change-cause of the CronJob are
+// read from its annotations. Earlier revisions are recovered from the Jobs it still controls, which only
+// carry a revision if the job template they were created from was annotated with one.
+func (h *CronJobHistoryViewer) ViewHistory(namespace, name string, revision int64) (string, error) {
+	revisionToTemplate, revisionToObject, err := cronJobRevisions(h.c, namespace, name)
+	if err != nil {
+		return "", err
+	}
+	if len(revisionToTemplate) == 0 {
+		return "No rollout history found.", nil
+	}
+
+	revisions := make([]RevisionInfo, 0, len(revisionToObject))
+	for r, obj := range revisionToObject {
+		revisions = append(revisions, RevisionInfo{Revision: r, ChangeCause: getChangeCause(obj)})
+	}
+
+	if revision > 0 {
+		// Print details of a specific revision
+		template, ok := revisionToTemplate[revision]
+		if !ok {
+			return "", revisionNotFound(revision, revisionNumbers(revisions))
+		}
+		if len(h.OutputFormat) > 0 {
+			return printStructured(template, h.OutputFormat)
+		}
+		return h.templatePrinter().PrintTemplate(template)
+	}
+
+	revisions = h.selectRevisions(revisions)
+	if len(h.OutputFormat) > 0 {
+		summary := historySummary{Revisions: []revisionSummary{}}
+		for _, r := range revisions {
+			summary.Revisions = append(summary.Revisions, newRevisionSummary(r, revisionToTemplate[r.Revision]))
+		}
+		return printStructured(summary, h.OutputFormat)
+	}
+	if len(revisions) == 0 {
+		return h.noMatchingHistory(), nil
 	}
-	sliceutil.SortInts64(revisions)
 
-	return tabbedString(func(out io.Writer) error {
+	return h.tabbedString(func(out io.Writer) error {
 		fmt.Fprintf(out, "REVISION\tCHANGE-CAUSE\n")
 		for _, r := range revisions {
-			// Find the change-cause of revision r
-			changeCause := historyInfo[r].Annotations[ChangeCauseAnnotation]
+			changeCause := r.ChangeCause
 			if len(changeCause) == 0 {
 				changeCause = "<none>"
 			}
-			fmt.Fprintf(out, "%d\t%s\n", r, changeCause)
+			fmt.Fprintf(out, "%d\t%s\n", r.Revision, changeCause)
 		}
 		return nil
 	})
 }
 
-func printTemplate(template *v1.PodTemplateSpec) (string, error) {
-	buf := bytes.NewBuffer([]byte{})
-	internalTemplate := &api.PodTemplateSpec{}
-	if err := apiv1.Convert_v1_PodTemplateSpec_To_api_PodTemplateSpec(template, internalTemplate, nil); err != nil {
-		return "", fmt.Errorf("failed to convert podtemplate, %v", err)
+// cronJobRevisions returns the pod templates of the revisions of the CronJob named name in namespace, and the
+// objects recording them, keyed by revision. The current revision is recorded by the CronJob itself, the others
+// by the Jobs it controls.
+func cronJobRevisions(c kubernetes.Interface, namespace, name string) (map[int64]*v1.PodTemplateSpec, map[int64]runtime.Object, error) {
+	var cronJob *batchv1beta1.CronJob
+	err := retryOnTransientError(func() (err error) {
+		cronJob, err = c.BatchV1beta1().CronJobs(namespace).Get(name, metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve CronJob %s: %v", name, err)
 	}
-	w := printersinternal.NewPrefixWriter(buf)
-	printersinternal.DescribePodTemplate(internalTemplate, w)
-	return buf.String(), nil
+	jobs, err := controlledJobs(c.BatchV1(), namespace, labels.SelectorFromSet(cronJob.Spec.JobTemplate.Labels), cronJob)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to find history of CronJob %s: %v", name, err)
+	}
+
+	revisionToTemplate := make(map[int64]*v1.PodTemplateSpec)
+	revisionToObject := make(map[int64]runtime.Object)
+	for _, job := range jobs {
+		v, err := deploymentutil.Revision(job)
+		if err != nil {
+			continue
+		}
+		revisionToTemplate[v] = &job.Spec.Template
+		revisionToObject[v] = job
+	}
+	// The revision and change-cause recorded on the CronJob win over those of a Job of the same revision,
+	// and it holds the latest template of its current revision
+	if v, err := deploymentutil.Revision(cronJob); err == nil {
+		revisionToTemplate[v] = &cronJob.Spec.JobTemplate.Spec.Template
+		revisionToObject[v] = cronJob
+	}
+	return revisionToTemplate, revisionToObject, nil
 }
 
 type DaemonSetHistoryViewer struct {
 	c kubernetes.Interface
+	HistoryOptions
 }
 
 // ViewHistory returns a revision-to-history map as the revision history of a deployment
@@ -159,8 +1041,15 @@ func (h *DaemonSetHistoryViewer) ViewHistory(namespace, name string, revision in
 		return "", err
 	}
 	historyInfo := make(map[int64]*appsv1beta1.ControllerRevision)
+	collisions := make(map[int64]bool)
 	for _, history := range history {
-		// TODO: for now we assume revisions don't overlap, we may need to handle it
+		// Revisions may overlap after a hash collision, in which case the most recent one wins
+		if existing, ok := historyInfo[history.Revision]; ok {
+			collisions[history.Revision] = true
+			if !newerHistory(history, existing) {
+				continue
+			}
+		}
 		historyInfo[history.Revision] = history
 	}
 	if len(historyInfo) == 0 {
@@ -171,32 +1060,70 @@ func (h *DaemonSetHistoryViewer) ViewHistory(namespace, name string, revision in
 	if revision > 0 {
 		history, ok := historyInfo[revision]
 		if !ok {
-			return "", fmt.Errorf("unable to find the specified revision")
+			revisions := make([]int64, 0, len(historyInfo))
+			for r := range historyInfo {
+				revisions = append(revisions, r)
+			}
+			return "", revisionNotFound(revision, revisions)
 		}
 		dsOfHistory, err := applyDaemonSetHistory(ds, history)
 		if err != nil {
 			return "", fmt.Errorf("unable to parse history %s", history.Name)
 		}
-		return printTemplate(&dsOfHistory.Spec.Template)
+		if len(h.OutputFormat) > 0 {
+			return printStructured(&dsOfHistory.Spec.Template, h.OutputFormat)
+		}
+		content, err := h.templatePrinter().PrintTemplate(&dsOfHistory.Spec.Template)
+		if err != nil {
+			return "", err
+		}
+		return h.withRawPatch(content, history)
 	}
 
-	// Print an overview of all Revisions
-	// Sort the revisionToChangeCause map by revision
-	revisions := make([]int64, 0, len(historyInfo))
-	for r := range historyInfo {
-		revisions = append(revisions, r)
+	// Print an overview of all Revisions, one per revision number
+	shown := make([]*appsv1beta1.ControllerRevision, 0, len(historyInfo))
+	for _, history := range historyInfo {
+		shown = append(shown, history)
 	}
-	sliceutil.SortInts64(revisions)
+	revisions, err := historyRevisions(shown, func(h *appsv1beta1.ControllerRevision) (bool, error) { return daemon.Match(ds, h) })
+	if err != nil {
+		return "", err
+	}
+	revisions = h.selectRevisions(revisions)
 
-	return tabbedString(func(out io.Writer) error {
-		fmt.Fprintf(out, "REVISION\tCHANGE-CAUSE\n")
+	if len(h.OutputFormat) > 0 {
+		summary := historySummary{Revisions: []revisionSummary{}}
+		for _, r := range revisions {
+			history := historyInfo[r.Revision]
+			dsOfHistory, err := applyDaemonSetHistory(ds, history)
+			if err != nil {
+				return "", fmt.Errorf("unable to parse history %s", history.Name)
+			}
+			rs := newRevisionSummary(r, &dsOfHistory.Spec.Template)
+			rs.Collision = collisions[r.Revision]
+			summary.Revisions = append(summary.Revisions, rs)
+		}
+		return printStructured(summary, h.OutputFormat)
+	}
+	if len(revisions) == 0 {
+		return h.noMatchingHistory(), nil
+	}
+
+	return h.tabbedString(func(out io.Writer) error {
+		fmt.Fprintf(out, "REVISION\tNAME\tCREATED\tCHANGE-CAUSE\n")
 		for _, r := range revisions {
-			// Find the change-cause of revision r
-			changeCause := historyInfo[r].Annotations[ChangeCauseAnnotation]
+			changeCause := r.ChangeCause
 			if len(changeCause) == 0 {
 				changeCause = "<none>"
 			}
-			fmt.Fprintf(out, "%d\t%s\n", r, changeCause)
+			marker := ""
+			if collisions[r.Revision] {
+				marker = "*"
+			}
+			fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", formatRevision(r, marker), r.Name, formatCreationTimestamp(r.CreationTime), changeCause)
+		}
+		if len(collisions) > 0 {
+			fmt.Fprintf(out, "\n* revision shared by multiple ControllerRevisions, showing the most recently created one\n")
 		}
 		return nil
 	})
@@ -204,13 +1131,14 @@ func (h *DaemonSetHistoryViewer) ViewHistory(namespace, name string, revision in
 
 type StatefulSetHistoryViewer struct {
 	c kubernetes.Interface
+	HistoryOptions
 }
 
 // ViewHistory returns a list of the revision history of a statefulset
 // TODO: this should be a describer
 // TODO: needs to implement detailed revision view
 func (h *StatefulSetHistoryViewer) ViewHistory(namespace, name string, revision int64) (string, error) {
-	_, history, err := statefulSetHistory(h.c.AppsV1beta1(), namespace, name)
+	sts, history, err := statefulSetHistory(h.c.AppsV1beta1(), namespace, name)
 	if err != nil {
 		return "", err
 	}
@@ -218,40 +1146,327 @@ func (h *StatefulSetHistoryViewer) ViewHistory(namespace, name string, revision
 	if len(history) <= 0 {
 		return "No rollout history found.", nil
 	}
-	revisions := make([]int64, len(history))
-	for _, revision := range history {
-		revisions = append(revisions, revision.Revision)
+
+	// Print details of a specific revision
+	if revision > 0 {
+		revisionHistory := FindHistory(revision, history)
+		if revisionHistory == nil {
+			return "", revisionNotFound(revision, historyRevisionNumbers(history))
+		}
+		stsOfHistory, err := statefulset.ApplyRevision(sts, revisionHistory)
+		if err != nil {
+			return "", fmt.Errorf("unable to parse history %s", revisionHistory.Name)
+		}
+		if len(h.OutputFormat) > 0 {
+			return printStructured(&stsOfHistory.Spec.Template, h.OutputFormat)
+		}
+		content, err := h.templatePrinter().PrintTemplate(&stsOfHistory.Spec.Template)
+		if err != nil {
+			return "", err
+		}
+		return h.withRawPatch(content, revisionHistory)
 	}
-	sliceutil.SortInts64(revisions)
 
-	return tabbedString(func(out io.Writer) error {
-		fmt.Fprintf(out, "REVISION\n")
+	revisions, err := historyRevisions(history, func(h *appsv1beta1.ControllerRevision) (bool, error) { return statefulset.Match(sts, h) })
+	if err != nil {
+		return "", err
+	}
+	revisions = h.selectRevisions(revisions)
+	if len(h.OutputFormat) > 0 {
+		nameToHistory := make(map[string]*appsv1beta1.ControllerRevision, len(history))
+		for _, history := range history {
+			nameToHistory[history.Name] = history
+		}
+		summary := historySummary{Revisions: []revisionSummary{}}
 		for _, r := range revisions {
-			fmt.Fprintf(out, "%d\n", r)
+			stsOfHistory, err := statefulset.ApplyRevision(sts, nameToHistory[r.Name])
+			if err != nil {
+				return "", fmt.Errorf("unable to parse history %s", r.Name)
+			}
+			summary.Revisions = append(summary.Revisions, newRevisionSummary(r, &stsOfHistory.Spec.Template))
+		}
+		return printStructured(summary, h.OutputFormat)
+	}
+	if len(revisions) == 0 {
+		return h.noMatchingHistory(), nil
+	}
+
+	return h.tabbedString(func(out io.Writer) error {
+		fmt.Fprintf(out, "REVISION\tNAME\tCREATED\tCHANGE-CAUSE\n")
+		for _, r := range revisions {
+			changeCause := r.ChangeCause
+			if len(changeCause) == 0 {
+				changeCause = "<none>"
+			}
+			fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", formatRevision(r, ""), r.Name, formatCreationTimestamp(r.CreationTime), changeCause)
+		}
+		return nil
+	})
+}
+
+// ViewHistoryAllNamespaces returns the revision history of the DaemonSets named name in all namespaces.
+// If revision is positive, only that revision is listed for each DaemonSet.
+func (h *DaemonSetHistoryViewer) ViewHistoryAllNamespaces(name string, revision int64) (string, error) {
+	var dsList *extensionsv1beta1.DaemonSetList
+	err := retryOnTransientError(func() (err error) {
+		dsList, err = h.c.ExtensionsV1beta1().DaemonSets(metav1.NamespaceAll).List(namedListOptions(name))
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list DaemonSets %s: %v", name, err)
+	}
+	var histories []namespacedHistory
+	for i := range dsList.Items {
+		ds := &dsList.Items[i]
+		if ds.Name != name {
+			continue
+		}
+		selector, err := historySelector("DaemonSet", ds.Namespace+"/"+ds.Name, ds.Spec.Selector)
+		if err != nil {
+			return "", err
+		}
+		history, err := controlledHistory(h.c.AppsV1beta1(), ds.Namespace, selector, ds)
+		if err != nil {
+			return "", fmt.Errorf("unable to find history controlled by DaemonSet %s/%s: %v", ds.Namespace, ds.Name, err)
+		}
+		histories = append(histories, namespacedHistory{namespace: ds.Namespace, history: history})
+	}
+	return printNamespacedHistory(histories, revision, h.HistoryOptions)
+}
+
+// ViewHistoryAllNamespaces returns the revision history of the StatefulSets named name in all namespaces.
+// If revision is positive, only that revision is listed for each StatefulSet.
+func (h *StatefulSetHistoryViewer) ViewHistoryAllNamespaces(name string, revision int64) (string, error) {
+	var stsList *appsv1beta1.StatefulSetList
+	err := retryOnTransientError(func() (err error) {
+		stsList, err = h.c.AppsV1beta1().StatefulSets(metav1.NamespaceAll).List(namedListOptions(name))
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list StatefulSets %s: %v", name, err)
+	}
+	var histories []namespacedHistory
+	for i := range stsList.Items {
+		sts := &stsList.Items[i]
+		if sts.Name != name {
+			continue
+		}
+		selector, err := historySelector("StatefulSet", sts.Namespace+"/"+sts.Name, sts.Spec.Selector)
+		if err != nil {
+			return "", err
+		}
+		history, err := controlledHistory(h.c.AppsV1beta1(), sts.Namespace, selector, sts)
+		if err != nil {
+			return "", fmt.Errorf("unable to find history controlled by StatefulSet %s/%s: %v", sts.Namespace, sts.Name, err)
+		}
+		histories = append(histories, namespacedHistory{namespace: sts.Namespace, history: history})
+	}
+	return printNamespacedHistory(histories, revision, h.HistoryOptions)
+}
+
+// namespacedHistory holds the ControllerRevisions of a single object and the namespace it lives in.
+type namespacedHistory struct {
+	namespace string
+	history   []*appsv1beta1.ControllerRevision
+}
+
+// namedListOptions returns list options selecting the objects named name.
+func namedListOptions(name string) metav1.ListOptions {
+	return metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String()}
+}
+
+// printNamespacedHistory prints a table of the revisions of each object in histories, prefixed by
+// the namespace of the object, or a list of history summaries if an output format is set. If
+// revision is positive, only that revision is printed.
+func printNamespacedHistory(histories []namespacedHistory, revision int64, opts HistoryOptions) (string, error) {
+	sort.Slice(histories, func(i, j int) bool { return histories[i].namespace < histories[j].namespace })
+	summaries := []historySummary{}
+	for _, h := range histories {
+		historyInfo := make(map[int64]*appsv1beta1.ControllerRevision)
+		for _, history := range h.history {
+			if revision > 0 && history.Revision != revision {
+				continue
+			}
+			if existing, ok := historyInfo[history.Revision]; ok && !newerHistory(history, existing) {
+				continue
+			}
+			historyInfo[history.Revision] = history
+		}
+		revisions := make([]RevisionInfo, 0, len(historyInfo))
+		for r, history := range historyInfo {
+			revisions = append(revisions, RevisionInfo{
+				Revision:     r,
+				Name:         history.Name,
+				ChangeCause:  getChangeCause(history),
+				CreationTime: history.CreationTimestamp,
+			})
+		}
+		revisions = opts.selectRevisions(revisions)
+		if len(revisions) == 0 {
+			continue
+		}
+		summary := historySummary{Namespace: h.namespace, Revisions: []revisionSummary{}}
+		for _, r := range revisions {
+			summary.Revisions = append(summary.Revisions, revisionSummary{
+				Revision:          r.Revision,
+				Name:              r.Name,
+				ChangeCause:       r.ChangeCause,
+				CreationTimestamp: r.CreationTime,
+			})
+		}
+		summaries = append(summaries, summary)
+	}
+	if len(opts.OutputFormat) > 0 {
+		return printStructured(summaries, opts.OutputFormat)
+	}
+	if len(summaries) == 0 {
+		if len(opts.ChangeCauseFilter) > 0 {
+			return opts.noMatchingHistory(), nil
+		}
+		return "No rollout history found.", nil
+	}
+
+	return opts.tabbedString(func(out io.Writer) error {
+		fmt.Fprintf(out, "NAMESPACE\tREVISION\tNAME\tCREATED\tCHANGE-CAUSE\n")
+		for _, summary := range summaries {
+			for _, r := range summary.Revisions {
+				created := formatCreationTimestamp(r.CreationTimestamp)
+				changeCause := r.ChangeCause
+				if len(changeCause) == 0 {
+					changeCause = "<none>"
+				}
+				fmt.Fprintf(out, "%s\t%d\t%s\t%s\t%s\n", summary.Namespace, r.Revision, r.Name, created, changeCause)
+			}
 		}
 		return nil
 	})
 }
 
-// controlledHistories returns all ControllerRevisions in namespace that selected by selector and owned by accessor
+// PruneHistory deletes all but the keep most recent ControllerRevisions of the DaemonSet or StatefulSet
+// named name in namespace, and returns the number of revisions deleted. The revision matching the
+// current state of the live object is never deleted. Nothing is deleted if there are at most keep revisions.
+// Revisions that are already gone, for example because another prune deleted them first, are not counted.
+// c is a full clientset rather than an apps client because DaemonSets are retrieved through the extensions API.
+func PruneHistory(c kubernetes.Interface, namespace, name string, kind schema.GroupKind, keep int) (int, error) {
+	if keep < 0 {
+		return 0, fmt.Errorf("the number of revisions to keep must be a non-negative integer: %d", keep)
+	}
+	var history []*appsv1beta1.ControllerRevision
+	var match func(*appsv1beta1.ControllerRevision) (bool, error)
+	switch kind {
+	case extensions.Kind("DaemonSet"), apps.Kind("DaemonSet"):
+		ds, dsHistory, err := daemonSetHistory(c.ExtensionsV1beta1(), c.AppsV1beta1(), namespace, name)
+		if err != nil {
+			return 0, err
+		}
+		history = dsHistory
+		match = func(h *appsv1beta1.ControllerRevision) (bool, error) { return daemon.Match(ds, h) }
+	case apps.Kind("StatefulSet"):
+		sts, stsHistory, err := statefulSetHistory(c.AppsV1beta1(), namespace, name)
+		if err != nil {
+			return 0, err
+		}
+		history = stsHistory
+		match = func(h *appsv1beta1.ControllerRevision) (bool, error) { return statefulset.Match(sts, h) }
+	default:
+		return 0, &UnsupportedKindError{Kind: kind, Operation: "history pruner"}
+	}
+
+	if len(history) <= keep {
+		return 0, nil
+	}
+	sort.Sort(HistoriesByRevision(history))
+	deleted := 0
+	for _, h := range history[:len(history)-keep] {
+		// Never delete the revision the live object is running
+		live, err := match(h)
+		if err != nil {
+			return deleted, err
+		}
+		if live {
+			continue
+		}
+		err = c.AppsV1beta1().ControllerRevisions(namespace).Delete(h.Name, nil)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete ControllerRevision %s: %v", h.Name, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// newerHistory returns true if history a was created after history b. Histories created
+// at the same time are ordered by name, so that the result is always deterministic.
+func newerHistory(a, b *appsv1beta1.ControllerRevision) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return b.CreationTimestamp.Before(&a.CreationTimestamp)
+	}
+	return a.Name > b.Name
+}
+
+// HistoryPageSize is the maximum number of ControllerRevisions retrieved per List call when looking up
+// the history of a DaemonSet or StatefulSet. Zero lists them all at once.
+var HistoryPageSize int64 = 500
+
+// controlledHistories returns all ControllerRevisions in namespace that selected by selector and owned by accessor.
+// ControllerRevisions are listed in pages of HistoryPageSize, only the owned ones of each page are kept.
 func controlledHistory(
 	apps clientappsv1beta1.AppsV1beta1Interface,
 	namespace string,
 	selector labels.Selector,
 	accessor metav1.Object) ([]*appsv1beta1.ControllerRevision, error) {
 	var result []*appsv1beta1.ControllerRevision
-	historyList, err := apps.ControllerRevisions(namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
-	if err != nil {
-		return nil, err
+	options := metav1.ListOptions{LabelSelector: selector.String(), Limit: HistoryPageSize}
+	for {
+		var historyList *appsv1beta1.ControllerRevisionList
+		err := retryOnTransientError(func() (err error) {
+			historyList, err = apps.ControllerRevisions(namespace).List(options)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := range historyList.Items {
+			history := historyList.Items[i]
+			// Only add history that belongs to the API object
+			if metav1.IsControlledBy(&history, accessor) {
+				result = append(result, &history)
+			}
+		}
+		if len(historyList.Continue) == 0 {
+			return result, nil
+		}
+		options.Continue = historyList.Continue
 	}
-	for i := range historyList.Items {
-		history := historyList.Items[i]
-		// Only add history that belongs to the API object
-		if metav1.IsControlledBy(&history, accessor) {
-			result = append(result, &history)
+}
+
+// controlledJobs returns all Jobs in namespace that are selected by selector and controlled by cronJob. As in
+// controlledHistory, Jobs are listed in pages of HistoryPageSize, only the controlled ones of each page are kept.
+func controlledJobs(batch clientbatchv1.BatchV1Interface, namespace string, selector labels.Selector, cronJob metav1.Object) ([]*batchv1.Job, error) {
+	var result []*batchv1.Job
+	options := metav1.ListOptions{LabelSelector: selector.String(), Limit: HistoryPageSize}
+	for {
+		var jobs *batchv1.JobList
+		err := retryOnTransientError(func() (err error) {
+			jobs, err = batch.Jobs(namespace).List(options)
+			return err
+		})
+		if err != nil {
+			return nil, err
 		}
+		for i := range jobs.Items {
+			if metav1.IsControlledBy(&jobs.Items[i], cronJob) {
+				result = append(result, &jobs.Items[i])
+			}
+		}
+		if len(jobs.Continue) == 0 {
+			return result, nil
+		}
+		options.Continue = jobs.Continue
 	}
-	return result, nil
 }
 
 // daemonSetHistory returns the DaemonSet named name in namespace and all ControllerRevisions in its history.
@@ -259,13 +1474,17 @@ func daemonSetHistory(
 	ext clientextv1beta1.ExtensionsV1beta1Interface,
 	apps clientappsv1beta1.AppsV1beta1Interface,
 	namespace, name string) (*extensionsv1beta1.DaemonSet, []*appsv1beta1.ControllerRevision, error) {
-	ds, err := ext.DaemonSets(namespace).Get(name, metav1.GetOptions{})
+	var ds *extensionsv1beta1.DaemonSet
+	err := retryOnTransientError(func() (err error) {
+		ds, err = ext.DaemonSets(namespace).Get(name, metav1.GetOptions{})
+		return err
+	})
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to retrieve DaemonSet %s: %v", name, err)
 	}
-	selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+	selector, err := historySelector("DaemonSet", ds.Name, ds.Spec.Selector)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create selector for DaemonSet %s: %v", ds.Name, err)
+		return nil, nil, err
 	}
 	accessor, err := meta.Accessor(ds)
 	if err != nil {
@@ -282,13 +1501,17 @@ func daemonSetHistory(
 func statefulSetHistory(
 	apps clientappsv1beta1.AppsV1beta1Interface,
 	namespace, name string) (*appsv1beta1.StatefulSet, []*appsv1beta1.ControllerRevision, error) {
-	sts, err := apps.StatefulSets(namespace).Get(name, metav1.GetOptions{})
+	var sts *appsv1beta1.StatefulSet
+	err := retryOnTransientError(func() (err error) {
+		sts, err = apps.StatefulSets(namespace).Get(name, metav1.GetOptions{})
+		return err
+	})
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to retrieve Statefulset %s: %s", name, err.Error())
 	}
-	selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+	selector, err := historySelector("StatefulSet", name, sts.Spec.Selector)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create selector for StatefulSet %s: %s", name, err.Error())
+		return nil, nil, err
 	}
 	accessor, err := meta.Accessor(sts)
 	if err != nil {
@@ -301,6 +1524,60 @@ func statefulSetHistory(
 	return sts, history, nil
 }
 
+// historySelector converts selector, the selector of the kind object named name, into the selector of
+// its ControllerRevisions. A nil or empty selector is an error, since it would select none or all of the
+// ControllerRevisions instead of the history of the object.
+func historySelector(kind, name string, selector *metav1.LabelSelector) (labels.Selector, error) {
+	if selector == nil || (len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0) {
+		return nil, fmt.Errorf("%s %s has no selector; cannot enumerate revision history", kind, name)
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create selector for %s %s: %v", kind, name, err)
+	}
+	return s, nil
+}
+
+// HistoryBackoff controls how the API calls made to retrieve rollout history are retried
+// when they fail with a transient error. Steps is the maximum number of attempts per call.
+var HistoryBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: 100 * time.Millisecond,
+	Factor:   2.0,
+	Jitter:   0.1,
+}
+
+// retryOnTransientError calls fn until it succeeds, returns an error that is not transient
+// or HistoryBackoff is exhausted, and returns the last error seen.
+func retryOnTransientError(fn func() error) error {
+	backoff := HistoryBackoff
+	if backoff.Steps < 1 {
+		backoff.Steps = 1
+	}
+	var lastErr error
+	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
+		lastErr = fn()
+		switch {
+		case lastErr == nil:
+			return true, nil
+		case isTransientError(lastErr):
+			return false, nil
+		default:
+			return false, lastErr
+		}
+	})
+	if err == wait.ErrWaitTimeout {
+		return lastErr
+	}
+	return err
+}
+
+// isTransientError returns true if err is likely to go away when the request is retried.
+func isTransientError(err error) bool {
+	return errors.IsTooManyRequests(err) || errors.IsServerTimeout(err) || errors.IsTimeout(err) ||
+		utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err)
+}
+
 // applyDaemonSetHistory returns a specific revision of DaemonSet by applying the given history to a copy of the given DaemonSet
 func applyDaemonSetHistory(ds *extensionsv1beta1.DaemonSet, history *appsv1beta1.ControllerRevision) (*extensionsv1beta1.DaemonSet, error) {
 	clone := ds.DeepCopy()
@@ -319,11 +1596,28 @@ func applyDaemonSetHistory(ds *extensionsv1beta1.DaemonSet, history *appsv1beta1
 	return clone, nil
 }
 
+// tabbedOptions controls the column layout of the tables rendered by tabbedStringWithOptions.
+type tabbedOptions struct {
+	// MinWidth is the minimal width of a column, including its padding.
+	MinWidth int
+	// Padding is the number of spaces added to the width of a column.
+	Padding int
+}
+
+// defaultTabbedOptions is the column layout used by tabbedString.
+var defaultTabbedOptions = tabbedOptions{MinWidth: 0, Padding: 2}
+
 // TODO: copied here until this becomes a describer
 func tabbedString(f func(io.Writer) error) (string, error) {
+	return tabbedStringWithOptions(f, defaultTabbedOptions)
+}
+
+// tabbedStringWithOptions renders the tab separated columns written by f as aligned columns laid out
+// according to opts.
+func tabbedStringWithOptions(f func(io.Writer) error, opts tabbedOptions) (string, error) {
 	out := new(tabwriter.Writer)
 	buf := &bytes.Buffer{}
-	out.Init(buf, 0, 8, 2, ' ', 0)
+	out.Init(buf, opts.MinWidth, 8, opts.Padding, ' ', 0)
 
 	err := f(out)
 	if err != nil {
@@ -341,5 +1635,14 @@ func getChangeCause(obj runtime.Object) string {
 	if err != nil {
 		return ""
 	}
-	return accessor.GetAnnotations()[ChangeCauseAnnotation]
+	return annotatedChangeCause(accessor.GetAnnotations())
+}
+
+// annotatedChangeCause returns the change-cause in annotations, read from ChangeCauseAnnotationKey or, if
+// that is not set, from ChangeCauseAnnotation
+func annotatedChangeCause(annotations map[string]string) string {
+	if changeCause := annotations[ChangeCauseAnnotationKey]; len(changeCause) > 0 {
+		return changeCause
+	}
+	return annotations[ChangeCauseAnnotation]
 }
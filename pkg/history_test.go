@@ -0,0 +1,1315 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	"k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	clientappsv1beta1 "k8s.io/client-go/kubernetes/typed/apps/v1beta1"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/kubernetes/pkg/apis/apps"
+	"k8s.io/kubernetes/pkg/apis/batch"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+)
+
+func TestPruneHistory(t *testing.T) {
+	tests := []struct {
+		name        string
+		liveImage   string
+		keep        int
+		expectCount int
+		expectLeft  []string
+	}{
+		{
+			name:        "keep most recent",
+			liveImage:   "foo:v4",
+			keep:        2,
+			expectCount: 2,
+			expectLeft:  []string{"foo-3", "foo-4"},
+		},
+		{
+			name:        "never delete live revision",
+			liveImage:   "foo:v1",
+			keep:        2,
+			expectCount: 1,
+			expectLeft:  []string{"foo-1", "foo-3", "foo-4"},
+		},
+		{
+			name:        "fewer revisions than keep",
+			liveImage:   "foo:v4",
+			keep:        5,
+			expectCount: 0,
+			expectLeft:  []string{"foo-1", "foo-2", "foo-3", "foo-4"},
+		},
+	}
+	for _, test := range tests {
+		ds := rollbackTestDaemonSet(test.liveImage)
+		gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+		objects := []runtime.Object{ds}
+		for i, image := range []string{"foo:v1", "foo:v2", "foo:v3", "foo:v4"} {
+			objects = append(objects, rollbackTestHistory(t, ds, gvk, int64(i+1), rollbackTestTemplate(image)))
+		}
+		client := newPatchingClientset(objects...)
+
+		deleted, err := PruneHistory(client, ds.Namespace, ds.Name, extensions.Kind("DaemonSet"), test.keep)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if deleted != test.expectCount {
+			t.Errorf("%s: expected %d deleted revisions, got %d", test.name, test.expectCount, deleted)
+		}
+		list, err := client.AppsV1beta1().ControllerRevisions(ds.Namespace).List(metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		left := []string{}
+		for _, history := range list.Items {
+			left = append(left, history.Name)
+		}
+		sort.Strings(left)
+		if !reflect.DeepEqual(left, test.expectLeft) {
+			t.Errorf("%s: expected remaining revisions %v, got %v", test.name, test.expectLeft, left)
+		}
+	}
+}
+
+func TestPruneHistoryConcurrentDelete(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v3")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := newPatchingClientset(ds,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")),
+		rollbackTestHistory(t, ds, gvk, 3, rollbackTestTemplate("foo:v3")),
+	)
+	// Another prune deletes revision 1 first
+	client.PrependReactor("delete", "controllerrevisions", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if name := action.(clienttesting.DeleteAction).GetName(); name == "foo-1" {
+			return true, nil, errors.NewNotFound(apps.Resource("controllerrevisions"), name)
+		}
+		return false, nil, nil
+	})
+
+	deleted, err := PruneHistory(client, ds.Namespace, ds.Name, extensions.Kind("DaemonSet"), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 deleted revision, got %d", deleted)
+	}
+}
+
+func TestDaemonSetHistoryViewerRevisionCollision(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v1")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	now := metav1.Now()
+	later := metav1.NewTime(now.Add(time.Minute))
+
+	tests := []struct {
+		name        string
+		collisions  []*appsv1beta1.ControllerRevision
+		expectImage string
+	}{
+		{
+			name: "most recently created wins",
+			collisions: []*appsv1beta1.ControllerRevision{
+				collidingHistory(t, ds, gvk, "foo-b", now, "foo:old"),
+				collidingHistory(t, ds, gvk, "foo-a", later, "foo:new"),
+			},
+			expectImage: "foo:new",
+		},
+		{
+			name: "same creation time is ordered by name",
+			collisions: []*appsv1beta1.ControllerRevision{
+				collidingHistory(t, ds, gvk, "foo-b", now, "foo:b"),
+				collidingHistory(t, ds, gvk, "foo-a", now, "foo:a"),
+			},
+			expectImage: "foo:b",
+		},
+	}
+	for _, test := range tests {
+		// Try both list orders, the selected revision must not depend on it
+		for _, collisions := range [][]*appsv1beta1.ControllerRevision{
+			test.collisions,
+			{test.collisions[1], test.collisions[0]},
+		} {
+			objects := []runtime.Object{ds, rollbackTestHistory(t, ds, gvk, 4, rollbackTestTemplate("foo:v4"))}
+			for _, history := range collisions {
+				objects = append(objects, history)
+			}
+			viewer := &DaemonSetHistoryViewer{c: newPatchingClientset(objects...)}
+
+			overview, err := viewer.ViewHistory(ds.Namespace, ds.Name, 0)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+			if !strings.Contains(overview, "5*") || strings.Contains(overview, "4*") {
+				t.Errorf("%s: expected only revision 5 to be marked as a collision, got:\n%s", test.name, overview)
+			}
+
+			details, err := viewer.ViewHistory(ds.Namespace, ds.Name, 5)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+			if !strings.Contains(details, test.expectImage) {
+				t.Errorf("%s: expected revision 5 to use image %q, got:\n%s", test.name, test.expectImage, details)
+			}
+		}
+	}
+}
+
+func collidingHistory(t *testing.T, owner metav1.Object, gvk schema.GroupVersionKind, name string, created metav1.Time, image string) *appsv1beta1.ControllerRevision {
+	history := rollbackTestHistory(t, owner, gvk, 5, rollbackTestTemplate(image))
+	history.Name = name
+	history.CreationTimestamp = created
+	return history
+}
+
+func TestStatefulSetHistoryViewerRevisionCollision(t *testing.T) {
+	sts := rollbackTestStatefulSet("foo:v1")
+	gvk := appsv1beta1.SchemeGroupVersion.WithKind("StatefulSet")
+	now := metav1.Now()
+	older := collidingHistory(t, sts, gvk, "foo-a", now, "foo:old")
+	newer := collidingHistory(t, sts, gvk, "foo-b", metav1.NewTime(now.Add(time.Minute)), "foo:new")
+
+	// Try both list orders, the selected revision must not depend on it
+	for _, collisions := range [][]*appsv1beta1.ControllerRevision{{older, newer}, {newer, older}} {
+		viewer := &StatefulSetHistoryViewer{c: fake.NewSimpleClientset(sts, collisions[0], collisions[1])}
+		details, err := viewer.ViewHistory(sts.Namespace, sts.Name, 5)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(details, "foo:new") {
+			t.Errorf("expected revision 5 to use image %q, got:\n%s", "foo:new", details)
+		}
+	}
+}
+
+func TestDaemonSetHistoryRetriesTransientErrors(t *testing.T) {
+	defer func(backoff wait.Backoff) { HistoryBackoff = backoff }(HistoryBackoff)
+	HistoryBackoff = wait.Backoff{Steps: 3, Duration: time.Millisecond, Factor: 1.0}
+
+	tooManyRequests := errors.NewTooManyRequests("slow down", 1)
+	notFound := errors.NewNotFound(extensions.Resource("daemonsets"), "foo")
+	tests := []struct {
+		name          string
+		errs          []error
+		expectErr     error
+		expectAttempt int
+	}{
+		{
+			name:          "succeeds after transient errors",
+			errs:          []error{tooManyRequests, errors.NewServerTimeout(extensions.Resource("daemonsets"), "get", 1)},
+			expectAttempt: 3,
+		},
+		{
+			name:          "non-retryable error surfaces immediately",
+			errs:          []error{notFound},
+			expectErr:     notFound,
+			expectAttempt: 1,
+		},
+		{
+			name:          "gives up after max attempts",
+			errs:          []error{tooManyRequests, tooManyRequests, tooManyRequests, tooManyRequests},
+			expectErr:     tooManyRequests,
+			expectAttempt: 3,
+		},
+	}
+	for _, test := range tests {
+		ds := rollbackTestDaemonSet("foo:v1")
+		client := fake.NewSimpleClientset(ds)
+		attempts := 0
+		client.PrependReactor("get", "daemonsets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			attempts++
+			if attempts <= len(test.errs) {
+				return true, nil, test.errs[attempts-1]
+			}
+			return false, nil, nil
+		})
+
+		_, _, err := daemonSetHistory(client.ExtensionsV1beta1(), client.AppsV1beta1(), ds.Namespace, ds.Name)
+		if test.expectErr == nil && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if test.expectErr != nil && (err == nil || !strings.Contains(err.Error(), test.expectErr.Error())) {
+			t.Errorf("%s: expected error %q, got %v", test.name, test.expectErr, err)
+		}
+		if attempts != test.expectAttempt {
+			t.Errorf("%s: expected %d attempts, got %d", test.name, test.expectAttempt, attempts)
+		}
+	}
+}
+
+func TestDeploymentRevisionHelpersRetryTransientErrors(t *testing.T) {
+	defer func(backoff wait.Backoff) { HistoryBackoff = backoff }(HistoryBackoff)
+	HistoryBackoff = wait.Backoff{Steps: 3, Duration: time.Millisecond, Factor: 1.0}
+
+	helpers := map[string]func(kubernetes.Interface) error{
+		"GetRevisionTemplate": func(c kubernetes.Interface) error {
+			_, err := GetRevisionTemplate(extensions.Kind("Deployment"), c, metav1.NamespaceDefault, "foo", 1)
+			return err
+		},
+		"MatchesRevision": func(c kubernetes.Interface) error {
+			_, err := MatchesRevision(extensions.Kind("Deployment"), c, metav1.NamespaceDefault, "foo", 1)
+			return err
+		},
+		"CurrentRevision": func(c kubernetes.Interface) error {
+			_, err := CurrentRevision(extensions.Kind("Deployment"), c, metav1.NamespaceDefault, "foo")
+			return err
+		},
+	}
+	for name, helper := range helpers {
+		deployment := rollbackTestDeployment("foo:v2")
+		client := fake.NewSimpleClientset(deployment, rollbackTestReplicaSet(deployment, 1, "foo:v1"), rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+		attempts := 0
+		client.PrependReactor("get", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			attempts++
+			if attempts == 1 {
+				return true, nil, errors.NewTooManyRequests("slow down", 1)
+			}
+			return false, nil, nil
+		})
+		if err := helper(client); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+		if attempts != 2 {
+			t.Errorf("%s: expected 2 attempts, got %d", name, attempts)
+		}
+	}
+}
+
+func TestDaemonSetHistoryViewerAllNamespaces(t *testing.T) {
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	newDaemonSet := func(namespace, name string) *extensionsv1beta1.DaemonSet {
+		ds := rollbackTestDaemonSet("foo:v1")
+		ds.Name, ds.Namespace, ds.UID = name, namespace, types.UID(namespace+"-"+name)
+		return ds
+	}
+	withChangeCause := func(history *appsv1beta1.ControllerRevision, changeCause string) *appsv1beta1.ControllerRevision {
+		history.Annotations = map[string]string{ChangeCauseAnnotation: changeCause}
+		return history
+	}
+	a := newDaemonSet("ns-a", "foo")
+	b := newDaemonSet("ns-b", "foo")
+	other := newDaemonSet("ns-b", "bar")
+	client := fake.NewSimpleClientset(b, a, other,
+		withChangeCause(rollbackTestHistory(t, a, gvk, 1, rollbackTestTemplate("foo:v1")), "a1"),
+		withChangeCause(rollbackTestHistory(t, a, gvk, 2, rollbackTestTemplate("foo:v2")), "a2"),
+		withChangeCause(rollbackTestHistory(t, b, gvk, 3, rollbackTestTemplate("foo:v3")), "b3"),
+		// Selected by the label selector of b, but controlled by another DaemonSet
+		withChangeCause(rollbackTestHistory(t, other, gvk, 7, rollbackTestTemplate("foo:v7")), "other7"),
+	)
+
+	viewer := &DaemonSetHistoryViewer{c: client}
+	result, err := viewer.ViewHistoryAllNamespaces("foo", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "NAMESPACE  REVISION  NAME   CREATED    CHANGE-CAUSE\n" +
+		"ns-a       1         foo-1  <unknown>  a1\n" +
+		"ns-a       2         foo-2  <unknown>  a2\n" +
+		"ns-b       3         foo-3  <unknown>  b3\n"
+	if result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	result, err = viewer.ViewHistoryAllNamespaces("foo", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = "NAMESPACE  REVISION  NAME   CREATED    CHANGE-CAUSE\n" +
+		"ns-a       2         foo-2  <unknown>  a2\n"
+	if result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	result, err = viewer.ViewHistoryAllNamespaces("baz", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "No rollout history found." {
+		t.Errorf("expected no history, got:\n%s", result)
+	}
+}
+
+func TestDaemonSetHistoryViewerChangeCauseFilter(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v3")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	var objects []runtime.Object
+	objects = append(objects, ds)
+	for i, changeCause := range []string{"deploy for TICKET-12", "bump image", "revert ticket-12"} {
+		history := rollbackTestHistory(t, ds, gvk, int64(i+1), rollbackTestTemplate("foo:v1"))
+		history.Annotations = map[string]string{ChangeCauseAnnotation: changeCause}
+		objects = append(objects, history)
+	}
+	client := fake.NewSimpleClientset(objects...)
+
+	tests := []struct {
+		filter   string
+		expected string
+	}{
+		{
+			filter: "",
+			expected: "REVISION  NAME   CREATED    CHANGE-CAUSE\n" +
+				"1         foo-1  <unknown>  deploy for TICKET-12\n" +
+				"2         foo-2  <unknown>  bump image\n" +
+				"3         foo-3  <unknown>  revert ticket-12\n",
+		},
+		{
+			filter: "Ticket-12",
+			expected: "REVISION  NAME   CREATED    CHANGE-CAUSE\n" +
+				"1         foo-1  <unknown>  deploy for TICKET-12\n" +
+				"3         foo-3  <unknown>  revert ticket-12\n",
+		},
+		{
+			filter:   "TICKET-99",
+			expected: "No rollout history matching TICKET-99.",
+		},
+	}
+	for _, test := range tests {
+		viewer := &DaemonSetHistoryViewer{c: client, HistoryOptions: HistoryOptions{ChangeCauseFilter: test.filter}}
+		result, err := viewer.ViewHistory(ds.Namespace, ds.Name, 0)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.filter, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("%q: expected:\n%s\ngot:\n%s", test.filter, test.expected, result)
+		}
+	}
+}
+
+func TestStatefulSetHistoryViewerDescending(t *testing.T) {
+	sts := rollbackTestStatefulSet("foo:v3")
+	gvk := appsv1beta1.SchemeGroupVersion.WithKind("StatefulSet")
+	objects := []runtime.Object{sts}
+	for _, revision := range []int64{2, 3, 1} {
+		history := rollbackTestHistory(t, sts, gvk, revision, rollbackTestTemplate(fmt.Sprintf("foo:v%d", revision)))
+		history.CreationTimestamp = metav1.Date(2017, time.October, int(revision), 12, 0, 0, 0, time.UTC)
+		if revision == 2 {
+			history.Annotations = map[string]string{ChangeCauseAnnotation: "update to v2"}
+		}
+		objects = append(objects, history)
+	}
+	client := fake.NewSimpleClientset(objects...)
+
+	tests := []struct {
+		descending bool
+		filter     string
+		expected   string
+	}{
+		{
+			descending: false,
+			expected: "REVISION     NAME   CREATED               CHANGE-CAUSE\n" +
+				"1            foo-1  2017-10-01T12:00:00Z  <none>\n" +
+				"2            foo-2  2017-10-02T12:00:00Z  update to v2\n" +
+				"3 (current)  foo-3  2017-10-03T12:00:00Z  <none>\n",
+		},
+		{
+			descending: true,
+			expected: "REVISION     NAME   CREATED               CHANGE-CAUSE\n" +
+				"3 (current)  foo-3  2017-10-03T12:00:00Z  <none>\n" +
+				"2            foo-2  2017-10-02T12:00:00Z  update to v2\n" +
+				"1            foo-1  2017-10-01T12:00:00Z  <none>\n",
+		},
+		{
+			descending: false,
+			filter:     "V2",
+			expected: "REVISION  NAME   CREATED               CHANGE-CAUSE\n" +
+				"2         foo-2  2017-10-02T12:00:00Z  update to v2\n",
+		},
+	}
+	for _, test := range tests {
+		viewer := &StatefulSetHistoryViewer{c: client, HistoryOptions: HistoryOptions{Descending: test.descending, ChangeCauseFilter: test.filter}}
+		result, err := viewer.ViewHistory(sts.Namespace, sts.Name, 0)
+		if err != nil {
+			t.Errorf("descending=%t: unexpected error: %v", test.descending, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("descending=%t: expected:\n%s\ngot:\n%s", test.descending, test.expected, result)
+		}
+	}
+}
+
+func TestCurrentRevision(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	dsGVK := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	deployment := rollbackTestDeployment("foo:v2")
+
+	client := fake.NewSimpleClientset(ds,
+		rollbackTestHistory(t, ds, dsGVK, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, dsGVK, 2, rollbackTestTemplate("foo:v2")),
+		rollbackTestHistory(t, ds, dsGVK, 3, rollbackTestTemplate("foo:v3")),
+		deployment,
+		rollbackTestReplicaSet(deployment, 4, "foo:v1"),
+		rollbackTestReplicaSet(deployment, 5, "foo:v2"),
+		rollbackTestReplicaSet(deployment, 6, "foo:v3"),
+	)
+
+	tests := []struct {
+		kind     schema.GroupKind
+		expected int64
+	}{
+		{kind: extensions.Kind("DaemonSet"), expected: 2},
+		{kind: extensions.Kind("Deployment"), expected: 5},
+	}
+	for _, test := range tests {
+		revision, err := CurrentRevision(test.kind, client, metav1.NamespaceDefault, "foo")
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.kind, err)
+			continue
+		}
+		if revision != test.expected {
+			t.Errorf("%s: expected revision %d, got %d", test.kind, test.expected, revision)
+		}
+	}
+
+	if _, err := CurrentRevision(extensions.Kind("ReplicaSet"), client, metav1.NamespaceDefault, "foo"); err == nil {
+		t.Errorf("expected an error for an unsupported kind")
+	}
+}
+
+func TestReplicationControllerHistoryViewer(t *testing.T) {
+	unrelated := rollbackTestReplicationController("bar", 1, "bar:v1")
+	unrelated.Labels = map[string]string{"app": "bar"}
+	v2 := rollbackTestReplicationController("foo-2", 2, "foo:v2")
+	v2.Annotations[ChangeCauseAnnotation] = "update to v2"
+	client := fake.NewSimpleClientset(
+		rollbackTestReplicationController("foo-1", 1, "foo:v1"),
+		v2,
+		unrelated,
+	)
+	viewer := &ReplicationControllerHistoryViewer{c: client}
+
+	result, err := viewer.ViewHistory(metav1.NamespaceDefault, "foo-2", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "REVISION     NAME   CREATED    CHANGE-CAUSE\n" +
+		"1            foo-1  <unknown>  <none>\n" +
+		"2 (current)  foo-2  <unknown>  update to v2\n"
+	if result != expected {
+		t.Errorf("expected history:\n%s\ngot:\n%s", expected, result)
+	}
+
+	result, err = viewer.ViewHistory(metav1.NamespaceDefault, "foo-2", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result, "foo:v1") {
+		t.Errorf("expected revision 1 template with image foo:v1, got:\n%s", result)
+	}
+
+	if _, err := viewer.ViewHistory(metav1.NamespaceDefault, "foo-2", 3); err == nil {
+		t.Errorf("expected an error for a missing revision")
+	}
+}
+
+func TestDeploymentHistoryViewerShowImages(t *testing.T) {
+	deployment := rollbackTestDeployment("foo:v2")
+	v1RS := rollbackTestReplicaSet(deployment, 1, "foo:v1")
+	v1RS.Spec.Template.Spec.Containers = append(v1RS.Spec.Template.Spec.Containers, v1.Container{Name: "sidecar", Image: "sidecar:v1"})
+	client := fake.NewSimpleClientset(deployment, v1RS, rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+
+	tests := []struct {
+		showImages bool
+		expected   string
+	}{
+		{
+			expected: "REVISION     NAME   CREATED    CHANGE-CAUSE\n" +
+				"1            foo-1  <unknown>  <none>\n" +
+				"2 (current)  foo-2  <unknown>  <none>\n",
+		},
+		{
+			showImages: true,
+			expected: "REVISION     NAME   CREATED    CHANGE-CAUSE  IMAGES\n" +
+				"1            foo-1  <unknown>  <none>        foo=foo:v1,sidecar=sidecar:v1\n" +
+				"2 (current)  foo-2  <unknown>  <none>        foo=foo:v2\n",
+		},
+	}
+	for _, test := range tests {
+		viewer := &DeploymentHistoryViewer{c: client, HistoryOptions: HistoryOptions{ShowImages: test.showImages}}
+		result, err := viewer.ViewHistory(metav1.NamespaceDefault, "foo", 0)
+		if err != nil {
+			t.Errorf("showImages=%v: unexpected error: %v", test.showImages, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("showImages=%v: expected history:\n%s\ngot:\n%s", test.showImages, test.expected, result)
+		}
+	}
+}
+
+func TestHistoryViewerOutputFormat(t *testing.T) {
+	deployment := rollbackTestDeployment("foo:v2")
+	rs1 := rollbackTestReplicaSet(deployment, 1, "foo:v1")
+	rs1.Annotations[ChangeCauseAnnotation] = "initial"
+	client := fake.NewSimpleClientset(deployment, rs1, rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+
+	unmarshal := map[string]func([]byte, interface{}) error{
+		"json": json.Unmarshal,
+		"yaml": yaml.Unmarshal,
+	}
+	for format, unmarshal := range unmarshal {
+		viewer, err := HistoryViewerWithOptions(extensions.Kind("Deployment"), client, HistoryOptions{OutputFormat: format})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		result, err := viewer.ViewHistory(metav1.NamespaceDefault, "foo", 0)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		summary := historySummary{}
+		if err := unmarshal([]byte(result), &summary); err != nil {
+			t.Fatalf("%s: unexpected error parsing %q: %v", format, result, err)
+		}
+		expected := []revisionSummary{
+			{Revision: 1, Name: "foo-1", ChangeCause: "initial", Images: []string{"foo:v1"}},
+			{Revision: 2, Name: "foo-2", Images: []string{"foo:v2"}, Current: true},
+		}
+		if !reflect.DeepEqual(summary.Revisions, expected) {
+			t.Errorf("%s: expected revisions %#v, got %#v", format, expected, summary.Revisions)
+		}
+
+		result, err = viewer.ViewHistory(metav1.NamespaceDefault, "foo", 1)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		template := v1.PodTemplateSpec{}
+		if err := unmarshal([]byte(result), &template); err != nil {
+			t.Fatalf("%s: unexpected error parsing %q: %v", format, result, err)
+		}
+		if image := template.Spec.Containers[0].Image; image != "foo:v1" {
+			t.Errorf("%s: expected the template of revision 1, got image %s", format, image)
+		}
+	}
+
+	expected := `unsupported output format "xml", expected one of: json|yaml`
+	if _, err := HistoryViewerWithOptions(extensions.Kind("Deployment"), client, HistoryOptions{OutputFormat: "xml"}); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+	if _, err := RollbackerWithOptions(extensions.Kind("Deployment"), client, RollbackerOptions{OutputFormat: "xml"}); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestTabbedStringWithOptions(t *testing.T) {
+	write := func(out io.Writer) error {
+		fmt.Fprintf(out, "REVISION\tNAME\n")
+		fmt.Fprintf(out, "1\tfoo\n")
+		return nil
+	}
+	tests := []struct {
+		opts     tabbedOptions
+		expected string
+	}{
+		{opts: defaultTabbedOptions, expected: "REVISION  NAME\n1         foo\n"},
+		{opts: tabbedOptions{Padding: 4}, expected: "REVISION    NAME\n1           foo\n"},
+		{opts: tabbedOptions{MinWidth: 12, Padding: 2}, expected: "REVISION    NAME\n1           foo\n"},
+	}
+	for _, test := range tests {
+		result, err := tabbedStringWithOptions(write, test.opts)
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %v", test.opts, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("%+v: expected %q, got %q", test.opts, test.expected, result)
+		}
+	}
+}
+
+func TestHistoryViewerColumnOptions(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		rollbackTestReplicationController("foo-1", 1, "foo:v1"),
+		rollbackTestReplicationController("foo-2", 2, "foo:v2"),
+	)
+	zero, four := 0, 4
+	tests := []struct {
+		name     string
+		opts     HistoryOptions
+		expected string
+	}{
+		{
+			name: "default",
+			opts: HistoryOptions{},
+			expected: "REVISION     NAME   CREATED    CHANGE-CAUSE\n" +
+				"1            foo-1  <unknown>  <none>\n" +
+				"2 (current)  foo-2  <unknown>  <none>\n",
+		},
+		{
+			name: "padding",
+			opts: HistoryOptions{ColumnPadding: &four},
+			expected: "REVISION       NAME     CREATED      CHANGE-CAUSE\n" +
+				"1              foo-1    <unknown>    <none>\n" +
+				"2 (current)    foo-2    <unknown>    <none>\n",
+		},
+		{
+			name: "no padding",
+			opts: HistoryOptions{ColumnPadding: &zero, ColumnMinWidth: 12},
+			expected: "REVISION    NAME        CREATED     CHANGE-CAUSE\n" +
+				"1           foo-1       <unknown>   <none>\n" +
+				"2 (current) foo-2       <unknown>   <none>\n",
+		},
+		{
+			name: "min width",
+			opts: HistoryOptions{ColumnMinWidth: 12},
+			expected: "REVISION     NAME        CREATED     CHANGE-CAUSE\n" +
+				"1            foo-1       <unknown>   <none>\n" +
+				"2 (current)  foo-2       <unknown>   <none>\n",
+		},
+	}
+	for _, test := range tests {
+		viewer := &ReplicationControllerHistoryViewer{c: client, HistoryOptions: test.opts}
+		result, err := viewer.ViewHistory(metav1.NamespaceDefault, "foo-2", 0)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("%s: expected history:\n%s\ngot:\n%s", test.name, test.expected, result)
+		}
+	}
+}
+
+func TestStatefulSetHistoryViewerShowRawPatch(t *testing.T) {
+	sts := rollbackTestStatefulSet("foo:v2")
+	gvk := appsv1beta1.SchemeGroupVersion.WithKind("StatefulSet")
+	history := rollbackTestHistory(t, sts, gvk, 1, rollbackTestTemplate("foo:v1"))
+	client := fake.NewSimpleClientset(sts, history, rollbackTestHistory(t, sts, gvk, 2, rollbackTestTemplate("foo:v2")))
+
+	for _, showRawPatch := range []bool{false, true} {
+		printer := &recordingTemplatePrinter{}
+		viewer := &StatefulSetHistoryViewer{c: client, HistoryOptions: HistoryOptions{TemplatePrinter: printer, ShowRawPatch: showRawPatch}}
+		result, err := viewer.ViewHistory(metav1.NamespaceDefault, "foo", 1)
+		if err != nil {
+			t.Errorf("showRawPatch=%v: unexpected error: %v", showRawPatch, err)
+			continue
+		}
+		if len(printer.templates) != 1 || printer.templates[0].Spec.Containers[0].Image != "foo:v1" {
+			t.Errorf("showRawPatch=%v: expected the template of revision 1 to be printed, got %v", showRawPatch, printer.templates)
+		}
+		if !strings.HasPrefix(result, "template") {
+			t.Errorf("showRawPatch=%v: expected the described template, got:\n%s", showRawPatch, result)
+		}
+		if hasPatch := strings.Contains(result, "Revision Data:\n{\n    \"spec\""); hasPatch != showRawPatch {
+			t.Errorf("showRawPatch=%v: unexpected revision data in:\n%s", showRawPatch, result)
+		}
+	}
+}
+
+func TestListRevisions(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	dsGVK := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	dsV1 := rollbackTestHistory(t, ds, dsGVK, 1, rollbackTestTemplate("foo:v1"))
+	dsV1.Annotations = map[string]string{ChangeCauseAnnotation: "first"}
+	deployment := rollbackTestDeployment("foo:v1")
+
+	client := fake.NewSimpleClientset(ds,
+		rollbackTestHistory(t, ds, dsGVK, 2, rollbackTestTemplate("foo:v2")),
+		dsV1,
+		deployment,
+		rollbackTestReplicaSet(deployment, 3, "foo:v1"),
+		rollbackTestReplicaSet(deployment, 4, "foo:v2"),
+		// An older ReplicaSet running the same template as the deployment is not current
+		rollbackTestReplicaSet(deployment, 2, "foo:v1"),
+	)
+
+	tests := []struct {
+		kind     schema.GroupKind
+		expected []RevisionInfo
+	}{
+		{
+			kind: extensions.Kind("DaemonSet"),
+			expected: []RevisionInfo{
+				{Revision: 1, Name: dsV1.Name, ChangeCause: "first"},
+				{Revision: 2, Name: "foo-2", IsCurrent: true},
+			},
+		},
+		{
+			kind: extensions.Kind("Deployment"),
+			expected: []RevisionInfo{
+				{Revision: 2, Name: "foo-2"},
+				{Revision: 3, Name: "foo-3", IsCurrent: true},
+				{Revision: 4, Name: "foo-4"},
+			},
+		},
+	}
+	for _, test := range tests {
+		revisions, err := ListRevisions(test.kind, client, metav1.NamespaceDefault, "foo")
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.kind, err)
+			continue
+		}
+		if !reflect.DeepEqual(revisions, test.expected) {
+			t.Errorf("%s: expected revisions %+v, got %+v", test.kind, test.expected, revisions)
+		}
+	}
+
+	if _, err := ListRevisions(extensions.Kind("ReplicaSet"), client, metav1.NamespaceDefault, "foo"); err == nil {
+		t.Errorf("expected an error for an unsupported kind")
+	}
+}
+
+func TestDeploymentHistoryViewerDoesNotMutateReplicaSets(t *testing.T) {
+	deployment := rollbackTestDeployment("foo:v2")
+	rsList := &extensionsv1beta1.ReplicaSetList{}
+	for revision, image := range []string{"foo:v1", "foo:v2"} {
+		rs := rollbackTestReplicaSet(deployment, int64(revision+1), image)
+		rs.Annotations[ChangeCauseAnnotation] = fmt.Sprintf("deploy %s", image)
+		rs.Spec.Template.Annotations = map[string]string{"team": "foo"}
+		rsList.Items = append(rsList.Items, *rs)
+	}
+	expected := rsList.DeepCopy()
+
+	client := fake.NewSimpleClientset(deployment)
+	// Serve the same ReplicaSets on every list, like an informer cache would
+	client.PrependReactor("list", "replicasets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, rsList, nil
+	})
+	viewer := &DeploymentHistoryViewer{c: client}
+	if _, err := viewer.ViewHistory(metav1.NamespaceDefault, "foo", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := range rsList.Items {
+		if !reflect.DeepEqual(rsList.Items[i], expected.Items[i]) {
+			t.Errorf("expected ReplicaSet %s to be unchanged, got template annotations %v", rsList.Items[i].Name, rsList.Items[i].Spec.Template.Annotations)
+		}
+	}
+}
+
+func TestCronJobHistoryViewer(t *testing.T) {
+	cronJob := &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: metav1.NamespaceDefault,
+			UID:       "foo-uid",
+			Annotations: map[string]string{
+				"deployment.kubernetes.io/revision": "3",
+				ChangeCauseAnnotation:               "update to v3",
+			},
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule: "*/1 * * * *",
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"cronjob": "foo"}},
+				Spec:       batchv1.JobSpec{Template: rollbackTestTemplate("foo:v3")},
+			},
+		},
+	}
+	job := func(name string, revision int64, image string, owner *batchv1beta1.CronJob) *batchv1.Job {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   metav1.NamespaceDefault,
+				Annotations: map[string]string{"deployment.kubernetes.io/revision": fmt.Sprintf("%d", revision)},
+			},
+			Spec: batchv1.JobSpec{Template: rollbackTestTemplate(image)},
+		}
+		if owner != nil {
+			job.Labels = owner.Spec.JobTemplate.Labels
+			job.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(owner, batchv1beta1.SchemeGroupVersion.WithKind("CronJob"))}
+		}
+		return job
+	}
+	client := fake.NewSimpleClientset(cronJob,
+		job("foo-1", 1, "foo:v1", cronJob),
+		job("foo-2", 2, "foo:v2", cronJob),
+		// An older Job of the current revision, the CronJob template takes precedence
+		job("foo-3", 3, "foo:v2", cronJob),
+		job("bar-4", 4, "bar:v1", nil))
+	viewer := &CronJobHistoryViewer{c: client}
+
+	result, err := viewer.ViewHistory(metav1.NamespaceDefault, "foo", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "REVISION  CHANGE-CAUSE\n" +
+		"1         <none>\n" +
+		"2         <none>\n" +
+		"3         update to v3\n"
+	if result != expected {
+		t.Errorf("expected history:\n%s\ngot:\n%s", expected, result)
+	}
+	for _, action := range client.Actions() {
+		if list, ok := action.(clienttesting.ListAction); ok && action.GetResource().Resource == "jobs" {
+			if selector := list.GetListRestrictions().Labels.String(); selector != "cronjob=foo" {
+				t.Errorf("expected Jobs to be listed with the labels of the job template, got %q", selector)
+			}
+		}
+	}
+
+	printer := &recordingTemplatePrinter{}
+	viewer.TemplatePrinter = printer
+	for revision, image := range map[int64]string{1: "foo:v1", 3: "foo:v3"} {
+		printer.templates = nil
+		if _, err := viewer.ViewHistory(metav1.NamespaceDefault, "foo", revision); err != nil {
+			t.Errorf("revision %d: unexpected error: %v", revision, err)
+			continue
+		}
+		if len(printer.templates) != 1 || printer.templates[0].Spec.Containers[0].Image != image {
+			t.Errorf("revision %d: expected the template with image %q to be printed, got %v", revision, image, printer.templates)
+		}
+	}
+}
+
+func TestRevisionNotFound(t *testing.T) {
+	tests := []struct {
+		available []int64
+		expected  string
+	}{
+		{available: nil, expected: "unable to find specified revision 4 in history"},
+		{available: []int64{}, expected: "unable to find specified revision 4 in history (available revisions: <none>)"},
+		{available: []int64{3, 1, 3, 2}, expected: "unable to find specified revision 4 in history (available revisions: 1, 2, 3)"},
+	}
+	for _, test := range tests {
+		var available []int64
+		if test.available != nil {
+			available = make([]int64, len(test.available))
+			copy(available, test.available)
+		}
+		err := revisionNotFound(4, test.available)
+		if err.Error() != test.expected {
+			t.Errorf("%v: expected error %q, got %q", test.available, test.expected, err.Error())
+		}
+		if !reflect.DeepEqual(test.available, available) {
+			t.Errorf("%v: expected the available revisions not to be modified, got %v", available, test.available)
+		}
+	}
+}
+
+func TestHistoryViewerForObject(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	tests := []struct {
+		obj      runtime.Object
+		expected HistoryViewer
+	}{
+		{obj: rollbackTestDeployment("foo:v1"), expected: &DeploymentHistoryViewer{}},
+		{obj: rollbackTestDaemonSet("foo:v1"), expected: &DaemonSetHistoryViewer{}},
+		{obj: rollbackTestStatefulSet("foo:v1"), expected: &StatefulSetHistoryViewer{}},
+		{obj: rollbackTestReplicationController("foo", 1, "foo:v1"), expected: &ReplicationControllerHistoryViewer{}},
+		{obj: &batchv1beta1.CronJob{}, expected: &CronJobHistoryViewer{}},
+		{obj: &batch.CronJob{}, expected: &CronJobHistoryViewer{}},
+	}
+	for _, test := range tests {
+		viewer, err := HistoryViewerForObject(test.obj, client)
+		if err != nil {
+			t.Errorf("%T: unexpected error: %v", test.obj, err)
+			continue
+		}
+		if reflect.TypeOf(viewer) != reflect.TypeOf(test.expected) {
+			t.Errorf("%T: expected a %T, got %T", test.obj, test.expected, viewer)
+		}
+	}
+
+	if _, err := HistoryViewerForObject(&extensionsv1beta1.ReplicaSet{}, client); err == nil {
+		t.Errorf("expected an error for an unsupported kind")
+	}
+}
+
+func TestHistoryViewerRevisionRange(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v5")
+	sts := rollbackTestStatefulSet("foo:v5")
+	sts.Name, sts.UID = "bar", "bar-uid"
+	dsGVK := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	stsGVK := appsv1beta1.SchemeGroupVersion.WithKind("StatefulSet")
+	objects := []runtime.Object{ds, sts}
+	for revision := int64(1); revision <= 5; revision++ {
+		template := rollbackTestTemplate(fmt.Sprintf("foo:v%d", revision))
+		objects = append(objects, rollbackTestHistory(t, ds, dsGVK, revision, template), rollbackTestHistory(t, sts, stsGVK, revision, template))
+	}
+	client := fake.NewSimpleClientset(objects...)
+
+	tests := []struct {
+		name     string
+		options  HistoryOptions
+		expected []string
+	}{
+		{name: "unlimited", options: HistoryOptions{}, expected: []string{"1", "2", "3", "4", "5"}},
+		{name: "latest", options: HistoryOptions{Descending: true, Limit: 2}, expected: []string{"5", "4"}},
+		{name: "offset", options: HistoryOptions{Offset: 1, Limit: 2}, expected: []string{"2", "3"}},
+		{name: "limit past the end", options: HistoryOptions{Offset: 3, Limit: 10}, expected: []string{"4", "5"}},
+		{name: "negative offset", options: HistoryOptions{Offset: -1, Limit: 1}, expected: []string{"1"}},
+		{name: "offset past the end", options: HistoryOptions{Offset: 10}},
+	}
+	for _, test := range tests {
+		viewers := map[string]HistoryViewer{
+			"foo": &DaemonSetHistoryViewer{c: client, HistoryOptions: test.options},
+			"bar": &StatefulSetHistoryViewer{c: client, HistoryOptions: test.options},
+		}
+		for name, viewer := range viewers {
+			result, err := viewer.ViewHistory(metav1.NamespaceDefault, name, 0)
+			if err != nil {
+				t.Errorf("%s %s: unexpected error: %v", test.name, name, err)
+				continue
+			}
+			if len(test.expected) == 0 {
+				if result != "No rollout history found." {
+					t.Errorf("%s %s: unexpected result %q", test.name, name, result)
+				}
+				continue
+			}
+			var revisions []string
+			for _, line := range strings.Split(strings.TrimSpace(result), "\n")[1:] {
+				revisions = append(revisions, strings.Fields(line)[0])
+			}
+			if !reflect.DeepEqual(revisions, test.expected) {
+				t.Errorf("%s %s: expected revisions %v, got %v", test.name, name, test.expected, revisions)
+			}
+		}
+	}
+}
+
+func TestHistoryViewerCurrentMarker(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := fake.NewSimpleClientset(ds,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")),
+		rollbackTestHistory(t, ds, gvk, 3, rollbackTestTemplate("foo:v3")))
+
+	viewer := &DaemonSetHistoryViewer{c: client}
+	result, err := viewer.ViewHistory(ds.Namespace, ds.Name, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "REVISION     NAME   CREATED    CHANGE-CAUSE\n" +
+		"1            foo-1  <unknown>  <none>\n" +
+		"2 (current)  foo-2  <unknown>  <none>\n" +
+		"3            foo-3  <unknown>  <none>\n"
+	if result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	viewer.OutputFormat = "json"
+	result, err = viewer.ViewHistory(ds.Namespace, ds.Name, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Count(result, `"current": true`) != 1 || !strings.Contains(result, "\"revision\": 2,\n            \"name\": \"foo-2\"") {
+		t.Errorf("expected only revision 2 to be current, got:\n%s", result)
+	}
+
+	// Revisions that cannot be matched against the live object leave every revision unmarked
+	sts := rollbackTestStatefulSet("foo:v1")
+	sts.Name, sts.UID = "bar", "bar-uid"
+	broken := rollbackTestHistory(t, sts, appsv1beta1.SchemeGroupVersion.WithKind("StatefulSet"), 1, rollbackTestTemplate("foo:v1"))
+	broken.Data.Raw = []byte("not a patch")
+	stsViewer := &StatefulSetHistoryViewer{c: fake.NewSimpleClientset(sts, broken)}
+	result, err = stsViewer.ViewHistory(sts.Namespace, sts.Name, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(result, "(current)") {
+		t.Errorf("expected no current revision, got:\n%s", result)
+	}
+}
+
+func TestHistoryViewerNoSelector(t *testing.T) {
+	ds := &extensionsv1beta1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault},
+		Spec:       extensionsv1beta1.DaemonSetSpec{Template: rollbackTestTemplate("foo:v1")},
+	}
+	sts := &appsv1beta1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: metav1.NamespaceDefault},
+		Spec: appsv1beta1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{},
+			Template: rollbackTestTemplate("foo:v1"),
+		},
+	}
+	client := fake.NewSimpleClientset(ds, sts)
+
+	dsViewer := &DaemonSetHistoryViewer{c: client}
+	stsViewer := &StatefulSetHistoryViewer{c: client}
+	_, dsErr := dsViewer.ViewHistory(ds.Namespace, ds.Name, 0)
+	_, allNamespacesErr := dsViewer.ViewHistoryAllNamespaces(ds.Name, 0)
+	_, stsErr := stsViewer.ViewHistory(sts.Namespace, sts.Name, 0)
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{err: dsErr, expected: "DaemonSet foo has no selector; cannot enumerate revision history"},
+		{err: allNamespacesErr, expected: "DaemonSet default/foo has no selector; cannot enumerate revision history"},
+		{err: stsErr, expected: "StatefulSet bar has no selector; cannot enumerate revision history"},
+	}
+	for _, test := range tests {
+		if test.err == nil || test.err.Error() != test.expected {
+			t.Errorf("expected error %q, got %v", test.expected, test.err)
+		}
+	}
+}
+
+func TestGetRevisionTemplate(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v3")
+	sts := rollbackTestStatefulSet("foo:v3")
+	sts.Name, sts.UID = "bar", "bar-uid"
+	deployment := rollbackTestDeployment("foo:v3")
+	dsGVK := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	stsGVK := appsv1beta1.SchemeGroupVersion.WithKind("StatefulSet")
+	objects := []runtime.Object{ds, sts, deployment}
+	for revision := int64(1); revision <= 3; revision++ {
+		image := fmt.Sprintf("foo:v%d", revision)
+		objects = append(objects,
+			rollbackTestHistory(t, ds, dsGVK, revision, rollbackTestTemplate(image)),
+			rollbackTestHistory(t, sts, stsGVK, revision, rollbackTestTemplate(image)),
+			rollbackTestReplicaSet(deployment, revision, image))
+	}
+	client := fake.NewSimpleClientset(objects...)
+
+	tests := []struct {
+		name          string
+		revision      int64
+		expectedImage string
+		expectErr     bool
+	}{
+		{name: "found", revision: 1, expectedImage: "foo:v1"},
+		{name: "previous revision", revision: 0, expectedImage: "foo:v2"},
+		{name: "missing", revision: 4, expectErr: true},
+		{name: "negative", revision: -1, expectErr: true},
+	}
+	targets := map[schema.GroupKind]string{
+		extensions.Kind("Deployment"): "foo",
+		extensions.Kind("DaemonSet"):  "foo",
+		apps.Kind("StatefulSet"):      "bar",
+	}
+	for kind, name := range targets {
+		for _, test := range tests {
+			template, err := GetRevisionTemplate(kind, client, metav1.NamespaceDefault, name, test.revision)
+			if test.expectErr {
+				if _, ok := err.(*RevisionNotFoundError); !ok {
+					t.Errorf("%s %s: expected *RevisionNotFoundError, got %#v", kind, test.name, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s %s: unexpected error: %v", kind, test.name, err)
+				continue
+			}
+			if image := template.Spec.Containers[0].Image; image != test.expectedImage {
+				t.Errorf("%s %s: expected image %s, got %s", kind, test.name, test.expectedImage, image)
+			}
+			if hash, ok := template.Labels[extensionsv1beta1.DefaultDeploymentUniqueLabelKey]; ok {
+				t.Errorf("%s %s: expected no pod-template-hash label, got %q", kind, test.name, hash)
+			}
+		}
+	}
+
+	// Rolling back to the previous revision needs at least two revisions
+	deployment = rollbackTestDeployment("foo:v1")
+	ds = rollbackTestDaemonSet("foo:v1")
+	sts = rollbackTestStatefulSet("foo:v1")
+	sts.Name, sts.UID = "bar", "bar-uid"
+	client = fake.NewSimpleClientset(ds, sts, deployment,
+		rollbackTestHistory(t, ds, dsGVK, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, sts, stsGVK, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestReplicaSet(deployment, 1, "foo:v1"))
+	for kind, name := range targets {
+		_, err := GetRevisionTemplate(kind, client, metav1.NamespaceDefault, name, 0)
+		if noHistory, ok := err.(*NoHistoryError); !ok || noHistory.Name != name || len(noHistory.Kind) == 0 {
+			t.Errorf("%s: expected *NoHistoryError for %s, got %#v", kind, name, err)
+		}
+	}
+
+	if _, err := GetRevisionTemplate(extensions.Kind("ReplicaSet"), client, metav1.NamespaceDefault, "foo", 1); err == nil {
+		t.Errorf("expected an error for an unsupported kind")
+	}
+}
+
+func TestMatchesRevision(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	sts := rollbackTestStatefulSet("foo:v2")
+	sts.Name, sts.UID = "bar", "bar-uid"
+	deployment := rollbackTestDeployment("foo:v2")
+	dsGVK := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	stsGVK := appsv1beta1.SchemeGroupVersion.WithKind("StatefulSet")
+	client := fake.NewSimpleClientset(ds, sts, deployment,
+		rollbackTestHistory(t, ds, dsGVK, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, dsGVK, 2, rollbackTestTemplate("foo:v2")),
+		rollbackTestHistory(t, sts, stsGVK, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, sts, stsGVK, 2, rollbackTestTemplate("foo:v2")),
+		rollbackTestReplicaSet(deployment, 1, "foo:v1"),
+		rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+
+	tests := []struct {
+		kind     schema.GroupKind
+		name     string
+		revision int64
+		expected bool
+	}{
+		{kind: extensions.Kind("Deployment"), name: "foo", revision: 1, expected: false},
+		{kind: extensions.Kind("Deployment"), name: "foo", revision: 2, expected: true},
+		{kind: extensions.Kind("DaemonSet"), name: "foo", revision: 1, expected: false},
+		{kind: extensions.Kind("DaemonSet"), name: "foo", revision: 2, expected: true},
+		{kind: apps.Kind("StatefulSet"), name: "bar", revision: 1, expected: false},
+		{kind: apps.Kind("StatefulSet"), name: "bar", revision: 2, expected: true},
+	}
+	for _, test := range tests {
+		matches, err := MatchesRevision(test.kind, client, metav1.NamespaceDefault, test.name, test.revision)
+		if err != nil {
+			t.Errorf("%s revision %d: unexpected error: %v", test.kind, test.revision, err)
+			continue
+		}
+		if matches != test.expected {
+			t.Errorf("%s revision %d: expected %t, got %t", test.kind, test.revision, test.expected, matches)
+		}
+	}
+
+	for _, revision := range []int64{0, 3} {
+		if _, err := MatchesRevision(extensions.Kind("DaemonSet"), client, metav1.NamespaceDefault, "foo", revision); err == nil {
+			t.Errorf("expected an error for revision %d", revision)
+		}
+	}
+	if _, err := MatchesRevision(extensions.Kind("ReplicaSet"), client, metav1.NamespaceDefault, "foo", 1); err == nil {
+		t.Errorf("expected an error for an unsupported kind")
+	}
+}
+
+// pagedApps serves the ControllerRevisions in items in pages of the requested limit.
+type pagedApps struct {
+	clientappsv1beta1.AppsV1beta1Interface
+	items []appsv1beta1.ControllerRevision
+	// requests records the list options of each List call.
+	requests []metav1.ListOptions
+}
+
+func (a *pagedApps) ControllerRevisions(namespace string) clientappsv1beta1.ControllerRevisionInterface {
+	return pagedControllerRevisions{a.AppsV1beta1Interface.ControllerRevisions(namespace), a}
+}
+
+type pagedControllerRevisions struct {
+	clientappsv1beta1.ControllerRevisionInterface
+	apps *pagedApps
+}
+
+func (c pagedControllerRevisions) List(opts metav1.ListOptions) (*appsv1beta1.ControllerRevisionList, error) {
+	c.apps.requests = append(c.apps.requests, opts)
+	start := 0
+	if len(opts.Continue) > 0 {
+		var err error
+		if start, err = strconv.Atoi(opts.Continue); err != nil {
+			return nil, err
+		}
+	}
+	end := len(c.apps.items)
+	list := &appsv1beta1.ControllerRevisionList{}
+	if opts.Limit > 0 && start+int(opts.Limit) < end {
+		end = start + int(opts.Limit)
+		list.Continue = strconv.Itoa(end)
+	}
+	list.Items = c.apps.items[start:end]
+	return list, nil
+}
+
+func TestControlledHistoryPagination(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v1")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := &pagedApps{AppsV1beta1Interface: fake.NewSimpleClientset().AppsV1beta1()}
+	for revision := int64(1); revision <= 5; revision++ {
+		history := rollbackTestHistory(t, ds, gvk, revision, rollbackTestTemplate(fmt.Sprintf("foo:v%d", revision)))
+		if revision == 3 {
+			history.OwnerReferences = nil
+		}
+		client.items = append(client.items, *history)
+	}
+
+	defer func(pageSize int64) { HistoryPageSize = pageSize }(HistoryPageSize)
+	HistoryPageSize = 2
+	history, err := controlledHistory(client, ds.Namespace, labels.Everything(), ds)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var continues []string
+	for _, request := range client.requests {
+		if request.Limit != 2 {
+			t.Errorf("expected a limit of 2, got %d", request.Limit)
+		}
+		continues = append(continues, request.Continue)
+	}
+	if expected := []string{"", "2", "4"}; !reflect.DeepEqual(continues, expected) {
+		t.Errorf("expected pages starting at %q, got %q", expected, continues)
+	}
+	var revisions []int64
+	for _, h := range history {
+		revisions = append(revisions, h.Revision)
+	}
+	if expected := []int64{1, 2, 4, 5}; !reflect.DeepEqual(revisions, expected) {
+		t.Errorf("expected the owned revisions %v, got %v", expected, revisions)
+	}
+}
+
+func TestHistoryViewerChangeCauseAnnotationKey(t *testing.T) {
+	defer func(key string) { ChangeCauseAnnotationKey = key }(ChangeCauseAnnotationKey)
+	ChangeCauseAnnotationKey = "platform.example.com/release-note"
+
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	ds := rollbackTestDaemonSet("foo:v2")
+	first := rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1"))
+	first.Annotations = map[string]string{ChangeCauseAnnotation: "standard cause"}
+	second := rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2"))
+	second.Annotations = map[string]string{ChangeCauseAnnotation: "standard cause", ChangeCauseAnnotationKey: "release 2"}
+	viewer := &DaemonSetHistoryViewer{c: fake.NewSimpleClientset(ds, first, second)}
+	result, err := viewer.ViewHistory(metav1.NamespaceDefault, "foo", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "REVISION     NAME   CREATED    CHANGE-CAUSE\n" +
+		"1            foo-1  <unknown>  standard cause\n" +
+		"2 (current)  foo-2  <unknown>  release 2\n"
+	if result != expected {
+		t.Errorf("daemonset: expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	deployment := rollbackTestDeployment("foo:v2")
+	rs1 := rollbackTestReplicaSet(deployment, 1, "foo:v1")
+	rs2 := rollbackTestReplicaSet(deployment, 2, "foo:v2")
+	rs2.Annotations[ChangeCauseAnnotationKey] = "release 2"
+	deploymentViewer := &DeploymentHistoryViewer{c: fake.NewSimpleClientset(deployment, rs1, rs2)}
+	result, err = deploymentViewer.ViewHistory(metav1.NamespaceDefault, "foo", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = "REVISION     NAME   CREATED    CHANGE-CAUSE\n" +
+		"1            foo-1  <unknown>  <none>\n" +
+		"2 (current)  foo-2  <unknown>  release 2\n"
+	if result != expected {
+		t.Errorf("deployment: expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
@@ -17,128 +17,591 @@ limitations under the License.
 package pkg
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/ghodss/yaml"
 	appsv1beta1 "k8s.io/api/apps/v1beta1"
 	"k8s.io/api/core/v1"
 	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/api/legacyscheme"
-	apiv1 "k8s.io/kubernetes/pkg/api/v1"
 	"k8s.io/kubernetes/pkg/apis/apps"
 	"k8s.io/kubernetes/pkg/apis/extensions"
 	"k8s.io/kubernetes/pkg/controller/daemon"
 	deploymentutil "k8s.io/kubernetes/pkg/controller/deployment/util"
 	"k8s.io/kubernetes/pkg/controller/statefulset"
 	sliceutil "k8s.io/kubectl/pkg/util/slice"
-	printersinternal "k8s.io/kubernetes/pkg/printers/internalversion"
+	utilversion "k8s.io/kubernetes/pkg/util/version"
 )
 
 const (
 	rollbackSuccess = "rolled back"
 	rollbackSkipped = "skipped rollback"
+	// rollbackOnDelete is the result of rolling back a DaemonSet or StatefulSet whose pods
+	// are only updated when they are deleted.
+	rollbackOnDelete = "rolled back template; pods will update only when deleted because updateStrategy is OnDelete"
+	// rollbackSubmitted is the result of an asynchronous Deployment rollback.
+	rollbackSubmitted = "rollback submitted"
+	// rollforwardSuccess and rollforwardOnDelete replace rollbackSuccess and rollbackOnDelete when the
+	// target revision is newer than the current revision.
+	rollforwardSuccess  = "rolled forward"
+	rollforwardOnDelete = "rolled forward template; pods will update only when deleted because updateStrategy is OnDelete"
+
+	// RollbackFromRevisionAnnotation, RollbackToRevisionAnnotation and RollbackTimestampAnnotation are
+	// recorded on rolled back objects if RollbackerOptions.AuditAnnotations is set.
+	RollbackFromRevisionAnnotation = "rollback.kubernetes.io/from-revision"
+	RollbackToRevisionAnnotation   = "rollback.kubernetes.io/to-revision"
+	RollbackTimestampAnnotation    = "rollback.kubernetes.io/timestamp"
+
+	// dryRunAll is the value of the dryRun query parameter asking the API server to process
+	// a request in every stage without persisting it.
+	dryRunAll = "All"
 )
 
+// serverDryRunVersion is the first API server version supporting dry-run requests.
+var serverDryRunVersion = utilversion.MustParseGeneric("v1.13.0")
+
 // Rollbacker provides an interface for resources that can be rolled back.
 type Rollbacker interface {
 	Rollback(obj runtime.Object, updatedAnnotations map[string]string, toRevision int64, dryRun bool) (string, error)
 }
 
+// OptionsRollbacker is implemented by Rollbackers that can roll back as described by RollbackOptions.
+// All Rollbackers of this package implement it.
+type OptionsRollbacker interface {
+	Rollbacker
+	// RollbackWithOptions rolls back obj as described by opts. Rollback is equivalent to
+	// RollbackWithOptions with the matching fields of opts set.
+	RollbackWithOptions(obj runtime.Object, opts RollbackOptions) (string, error)
+}
+
+// RollbackOptions describes a single rollback.
+type RollbackOptions struct {
+	// UpdatedAnnotations are set on the rolled back object.
+	UpdatedAnnotations map[string]string
+	// ToRevision is the revision to roll back to. Zero rolls back to the last previously
+	// used revision.
+	ToRevision int64
+	// DryRun renders the result of the rollback without performing it.
+	DryRun bool
+}
+
+// RollbackerOptions holds the optional settings shared by all rollbackers.
+type RollbackerOptions struct {
+	// OutputFormat selects how a dry-run renders the target pod template. The empty
+	// string describes it in human-readable form, "json" and "yaml" serialize it.
+	OutputFormat string
+	// TemplatePrinter renders the target pod template of a human-readable dry-run.
+	// Defaults to DescribeTemplatePrinter.
+	TemplatePrinter TemplatePrinter
+	// WaitForRollout makes a Deployment or DaemonSet rollback block until the rolled back revision
+	// is fully rolled out and available, instead of returning once it is accepted. DaemonSets with
+	// the OnDelete update strategy are not waited for, their pods are only updated when deleted.
+	WaitForRollout bool
+	// Timeout bounds how long WaitForRollout waits, and how long a Deployment rollback is
+	// confirmed for. Watching for the rollback event and polling the deployment when the
+	// event isn't seen share the one deadline. Zero means the package default.
+	Timeout time.Duration
+	// ChangeCauseSource, if set, names the tool performing the rollback. It is recorded
+	// in a change-cause annotation on the rolled back resource, unless the caller
+	// already provides one in the updated annotations.
+	ChangeCauseSource string
+	// RequireChangeCause makes every rollback, including dry-runs, fail before anything is done unless
+	// it records a change-cause, either from the updated annotations or from ChangeCauseSource.
+	RequireChangeCause bool
+	// ServerDryRun makes a dry-run send the rollback to the API server in dry-run mode and
+	// render the object the server would persist, instead of reconstructing it locally.
+	// Dry-runs fall back to the local reconstruction if the server does not support it.
+	// Deployments are rolled back through a subresource that cannot be dry-run, so a patch
+	// of their pod template to the one of the target revision is dry-run instead.
+	// ReplicationController rollbacks do not support it and fail if it is set.
+	ServerDryRun bool
+	// ClearPartition makes a StatefulSet rollback reset a non-zero rolling update partition
+	// so that every pod is reverted. Otherwise the partition is kept, and the result warns
+	// about the pods it leaves on their current revision.
+	ClearPartition bool
+	// DryRunDiff makes a dry-run render only the pod template fields the rollback would change,
+	// comparing the live pod template with the target revision's, instead of the whole target
+	// pod template.
+	DryRunDiff bool
+	// DryRunManifest makes a dry-run render the whole object at the target revision as a YAML
+	// manifest that can be applied as is, instead of its pod template. The manifest carries the
+	// annotations the rollback would record, its status and server-managed metadata are removed.
+	// It takes precedence over OutputFormat and DryRunDiff.
+	DryRunManifest bool
+	// OnEvent, if set, is called as a rollback reaches each of its milestones. BatchRollback
+	// shares the options of its rollbackers between its workers, so OnEvent must be safe for
+	// concurrent use when Workers is greater than one.
+	OnEvent func(RollbackProgress)
+	// Async makes a Deployment rollback return as soon as it is submitted, without watching
+	// events or polling the Deployment for its outcome. WaitForRollout is ignored.
+	Async bool
+	// PatchType selects how a DaemonSet or StatefulSet rollback restores a revision. The
+	// default, StrategicMergePatchType, applies the patch stored in the ControllerRevision.
+	// MergePatchType rebuilds the object at the target revision and applies a JSON merge
+	// patch computed against the live object instead. ReplicationController rollbacks only
+	// support StrategicMergePatchType.
+	PatchType types.PatchType
+	// AuditAnnotations makes a rollback record the revision it rolls back from, the revision it
+	// rolls back to and when it happened in annotations on the rolled back object, in addition
+	// to any change-cause. The revision rolled back from is omitted if it cannot be determined.
+	AuditAnnotations bool
+}
+
+// RollbackStage is a milestone of a rollback reported through RollbackerOptions.OnEvent.
+type RollbackStage string
+
+const (
+	// RollbackStageSubmitted is reported once the rollback has been sent to the API server.
+	RollbackStageSubmitted RollbackStage = "Submitted"
+	// RollbackStageSkipped is reported when the rollback is skipped because the object already
+	// runs the target revision.
+	RollbackStageSkipped RollbackStage = "Skipped"
+	// RollbackStageEvent is reported for each rollback event seen while waiting for a Deployment
+	// rollback to be processed.
+	RollbackStageEvent RollbackStage = "Event"
+	// RollbackStageCompleted is reported with the result of a rollback that has been submitted.
+	RollbackStageCompleted RollbackStage = "Completed"
+)
+
+// RollbackProgress describes a milestone reached by a rollback.
+type RollbackProgress struct {
+	// Kind, Namespace and Name identify the object being rolled back.
+	Kind      schema.GroupKind
+	Namespace string
+	Name      string
+	Stage     RollbackStage
+	// Message is the rollback result for the Skipped and Completed stages, and the reason and
+	// message of the event for the Event stage.
+	Message string
+}
+
+// progressOf returns a function reporting the milestones of the rollback of the kind object obj to
+// OnEvent, if it is set.
+func (o RollbackerOptions) progressOf(kind schema.GroupKind, obj metav1.Object) func(RollbackStage, string) {
+	return func(stage RollbackStage, message string) {
+		if o.OnEvent != nil {
+			o.OnEvent(RollbackProgress{Kind: kind, Namespace: obj.GetNamespace(), Name: obj.GetName(), Stage: stage, Message: message})
+		}
+	}
+}
+
+// printDryRun renders the pod template of revision a dry-run would roll back to from the live pod template,
+// or roll forward to if forward is set. Human-readable output starts with a one-line summary of the changes.
+func (o RollbackerOptions) printDryRun(revision int64, forward bool, live, template *v1.PodTemplateSpec) (string, error) {
+	content, err := o.printDryRunTemplate(live, template, forward)
+	if err != nil || len(o.OutputFormat) > 0 {
+		return content, err
+	}
+	return dryRunSummary(revision, live, template) + content, nil
+}
+
+// printDryRunTemplate renders the pod template a dry-run would roll back to from the live pod template.
+func (o RollbackerOptions) printDryRunTemplate(live, template *v1.PodTemplateSpec, forward bool) (string, error) {
+	if o.DryRunDiff {
+		changes, err := diffPodTemplates(live, template)
+		if err != nil {
+			return "", err
+		}
+		return printTemplateChanges(changes, o.OutputFormat)
+	}
+	if len(o.OutputFormat) > 0 {
+		return printStructured(template, o.OutputFormat)
+	}
+	return printPodTemplate(o.templatePrinter(), template, forward)
+}
+
+// withChangeCause returns updatedAnnotations with a change-cause describing the rollback to toRevision
+// added, if ChangeCauseSource is set and updatedAnnotations has no non-empty change-cause yet. updatedAnnotations
+// itself is never modified.
+func (o RollbackerOptions) withChangeCause(updatedAnnotations map[string]string, toRevision int64) map[string]string {
+	if len(o.ChangeCauseSource) == 0 {
+		return updatedAnnotations
+	}
+	if len(annotatedChangeCause(updatedAnnotations)) > 0 {
+		return updatedAnnotations
+	}
+	annotations := make(map[string]string, len(updatedAnnotations)+1)
+	for k, v := range updatedAnnotations {
+		annotations[k] = v
+	}
+	annotations[ChangeCauseAnnotationKey] = fmt.Sprintf("rollback to revision %d via %s", toRevision, o.ChangeCauseSource)
+	return annotations
+}
+
+// checkChangeCause returns an error if RequireChangeCause is set but a rollback with updatedAnnotations
+// would not record a change-cause.
+func (o RollbackerOptions) checkChangeCause(updatedAnnotations map[string]string) error {
+	if !o.RequireChangeCause || len(o.ChangeCauseSource) > 0 || len(annotatedChangeCause(updatedAnnotations)) > 0 {
+		return nil
+	}
+	return fmt.Errorf("refusing to roll back without a change-cause; set the %s annotation", ChangeCauseAnnotationKey)
+}
+
+// withAuditAnnotations returns annotations with the audit annotations of a rollback from fromRevision to
+// toRevision added, if AuditAnnotations is set. A fromRevision below 1 is unknown and not recorded.
+// annotations itself is never modified.
+func (o RollbackerOptions) withAuditAnnotations(annotations map[string]string, fromRevision, toRevision int64) map[string]string {
+	if !o.AuditAnnotations {
+		return annotations
+	}
+	audited := make(map[string]string, len(annotations)+3)
+	for k, v := range annotations {
+		audited[k] = v
+	}
+	if fromRevision > 0 {
+		audited[RollbackFromRevisionAnnotation] = strconv.FormatInt(fromRevision, 10)
+	}
+	audited[RollbackToRevisionAnnotation] = strconv.FormatInt(toRevision, 10)
+	audited[RollbackTimestampAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	return audited
+}
+
+// rollbackAnnotations returns the annotations recorded on an object rolled back from fromRevision to
+// toRevision: the updated annotations of opts with a change-cause and the audit annotations added.
+func (o RollbackerOptions) rollbackAnnotations(opts RollbackOptions, fromRevision, toRevision int64) map[string]string {
+	return o.withAuditAnnotations(o.withChangeCause(opts.UpdatedAnnotations, toRevision), fromRevision, toRevision)
+}
+
+// patchType returns the configured PatchType, or StrategicMergePatchType if none is set.
+func (o RollbackerOptions) patchType() types.PatchType {
+	if len(o.PatchType) == 0 {
+		return types.StrategicMergePatchType
+	}
+	return o.PatchType
+}
+
+// timeout returns the configured Timeout, or the package default if none is set.
+func (o RollbackerOptions) timeout() time.Duration {
+	if o.Timeout == 0 {
+		return Timeout
+	}
+	return o.Timeout
+}
+
+// templatePrinter returns the configured TemplatePrinter, or the default one if none is set.
+func (o RollbackerOptions) templatePrinter() TemplatePrinter {
+	if o.TemplatePrinter == nil {
+		return DescribeTemplatePrinter{}
+	}
+	return o.TemplatePrinter
+}
+
 func RollbackerFor(kind schema.GroupKind, c kubernetes.Interface) (Rollbacker, error) {
+	return RollbackerWithOptions(kind, c, RollbackerOptions{})
+}
+
+// RollbackerForObject returns a Rollbacker for the kind of obj.
+func RollbackerForObject(obj runtime.Object, c kubernetes.Interface) (Rollbacker, error) {
+	kind, err := objectGroupKind(obj)
+	if err != nil {
+		return nil, err
+	}
+	return RollbackerFor(kind, c)
+}
+
+// RollbackerWithOptions returns a Rollbacker for the given kind configured with opts.
+func RollbackerWithOptions(kind schema.GroupKind, c kubernetes.Interface, opts RollbackerOptions) (Rollbacker, error) {
+	if err := validateOutputFormat(opts.OutputFormat); err != nil {
+		return nil, err
+	}
+	switch opts.patchType() {
+	case types.StrategicMergePatchType, types.MergePatchType:
+	default:
+		return nil, fmt.Errorf("unsupported patch type %q, expected one of: %s|%s", opts.PatchType, types.StrategicMergePatchType, types.MergePatchType)
+	}
 	switch kind {
 	case extensions.Kind("Deployment"), apps.Kind("Deployment"):
-		return &DeploymentRollbacker{c}, nil
+		return &DeploymentRollbacker{c: c, RollbackerOptions: opts}, nil
 	case extensions.Kind("DaemonSet"), apps.Kind("DaemonSet"):
-		return &DaemonSetRollbacker{c}, nil
+		return &DaemonSetRollbacker{c: c, RollbackerOptions: opts}, nil
 	case apps.Kind("StatefulSet"):
-		return &StatefulSetRollbacker{c}, nil
+		return &StatefulSetRollbacker{c: c, RollbackerOptions: opts}, nil
+	case api.Kind("ReplicationController"):
+		return &ReplicationControllerRollbacker{c: c, RollbackerOptions: opts}, nil
 	}
-	return nil, fmt.Errorf("no rollbacker has been implemented for %q", kind)
+	return nil, &UnsupportedKindError{Kind: kind, Operation: "rollbacker"}
 }
 
 type DeploymentRollbacker struct {
 	c kubernetes.Interface
+	RollbackerOptions
 }
 
 func (r *DeploymentRollbacker) Rollback(obj runtime.Object, updatedAnnotations map[string]string, toRevision int64, dryRun bool) (string, error) {
-	d, ok := obj.(*extensions.Deployment)
-	if !ok {
-		return "", fmt.Errorf("passed object is not a Deployment: %#v", obj)
+	return r.RollbackWithOptions(obj, RollbackOptions{UpdatedAnnotations: updatedAnnotations, ToRevision: toRevision, DryRun: dryRun})
+}
+
+// RollbackWithOptions rolls back obj as described by opts.
+func (r *DeploymentRollbacker) RollbackWithOptions(obj runtime.Object, opts RollbackOptions) (string, error) {
+	if err := r.checkChangeCause(opts.UpdatedAnnotations); err != nil {
+		return "", err
 	}
-	if dryRun {
-		return simpleDryRun(d, r.c, toRevision)
+	d, err := internalDeployment(obj)
+	if err != nil {
+		return "", err
+	}
+	progress := r.progressOf(extensions.Kind("Deployment"), d)
+	if opts.DryRun {
+		// Dry-runs render the live versioned deployment rather than converting d from the internal API
+		live, err := r.c.ExtensionsV1beta1().Deployments(d.Namespace).Get(d.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to retrieve deployment %s: %v", d.Name, err)
+		}
+		if err := checkSameObject(d, live); err != nil {
+			return "", err
+		}
+		if r.ServerDryRun && serverSupportsDryRun(r.c) {
+			// The server does not see the rollback, refuse what it would refuse
+			if live.Spec.Paused {
+				return "", &PausedError{Name: live.Name}
+			}
+			revision, applied, err := deploymentTemplatePatchDryRun(r.c, live, opts.ToRevision)
+			if err != nil {
+				return "", err
+			}
+			if r.DryRunManifest {
+				return printManifest(applied, extv1beta1.SchemeGroupVersion.WithKind("Deployment"), r.rollbackAnnotations(opts, annotatedRevision(live), revision))
+			}
+			return r.printDryRun(revision, rollsForward(annotatedRevision(live), revision), &live.Spec.Template, &applied.Spec.Template)
+		}
+		if r.DryRunManifest {
+			revision, applied, err := applyDeploymentRevision(live, r.c, opts.ToRevision)
+			if err != nil {
+				return "", err
+			}
+			return printManifest(applied, extv1beta1.SchemeGroupVersion.WithKind("Deployment"), r.rollbackAnnotations(opts, annotatedRevision(live), revision))
+		}
+		return simpleDryRun(live, r.c, opts.ToRevision, r.RollbackerOptions)
 	}
 	if d.Spec.Paused {
-		return "", fmt.Errorf("you cannot rollback a paused deployment; resume it first with 'kubectl rollout resume deployment/%s' and try again", d.Name)
+		return "", &PausedError{Name: d.Name}
+	}
+
+	// Skip if the revision already matches current Deployment
+	live, revision, template, err := deploymentRevisionTarget(r.c, d.Namespace, d.Name, opts.ToRevision)
+	if err != nil {
+		return "", err
 	}
+	if err := checkSameObject(d, live); err != nil {
+		return "", err
+	}
+	current := annotatedRevision(live)
+	if deploymentutil.EqualIgnoreHash(template, &live.Spec.Template) {
+		result := fmt.Sprintf("%s (current template already matches revision %d)", rollbackSkipped, revision)
+		progress(RollbackStageSkipped, result)
+		return result, nil
+	}
+
 	deploymentRollback := &extv1beta1.DeploymentRollback{
 		Name:               d.Name,
-		UpdatedAnnotations: updatedAnnotations,
+		UpdatedAnnotations: r.rollbackAnnotations(opts, current, revision),
 		RollbackTo: extv1beta1.RollbackConfig{
-			Revision: toRevision,
+			Revision: opts.ToRevision,
 		},
 	}
 	result := ""
 
-	// Get current events
-	events, err := r.c.CoreV1().Events(d.Namespace).List(metav1.ListOptions{})
-	if err != nil {
-		return result, err
+	if r.Async {
+		if err := r.c.ExtensionsV1beta1().Deployments(d.Namespace).Rollback(deploymentRollback); err != nil {
+			return result, err
+		}
+		progress(RollbackStageSubmitted, "")
+		progress(RollbackStageCompleted, rollbackSubmitted)
+		return rollbackSubmitted, nil
 	}
+
+	// Get current events
+	events, listErr := r.c.CoreV1().Events(d.Namespace).List(metav1.ListOptions{})
 	// Do the rollback
 	if err := r.c.ExtensionsV1beta1().Deployments(d.Namespace).Rollback(deploymentRollback); err != nil {
 		return result, err
 	}
+	progress(RollbackStageSubmitted, "")
+	deadline := time.Now().Add(r.timeout())
 	// Watch for the changes of events
-	watch, err := r.c.CoreV1().Events(d.Namespace).Watch(metav1.ListOptions{Watch: true, ResourceVersion: events.ResourceVersion})
-	if err != nil {
-		return result, err
+	if listErr == nil {
+		watch, err := r.c.CoreV1().Events(d.Namespace).Watch(metav1.ListOptions{Watch: true, ResourceVersion: events.ResourceVersion})
+		if err == nil {
+			result, err = watchRollbackEvent(watch, deadline.Sub(time.Now()), func(e *v1.Event) {
+				progress(RollbackStageEvent, fmt.Sprintf("%s: %s", e.Reason, e.Message))
+			})
+			if err != nil {
+				return "", err
+			}
+		}
 	}
-	result = watchRollbackEvent(watch)
+	// Fall back to polling the deployment if the events can't be watched, or the watch
+	// ended or timed out before the rollback event was seen
+	if len(result) == 0 {
+		result, err = r.pollRollback(d.Namespace, d.Name, template, deadline)
+		if err != nil {
+			return "", err
+		}
+	}
+	if result == rollbackSuccess && r.WaitForRollout {
+		if err := r.waitForRollout(d.Namespace, d.Name); err != nil {
+			return "", err
+		}
+	}
+	// The deployment controller restores any revision it still has a ReplicaSet of, newer ones included
+	result = rollResult(result, rollsForward(current, revision))
+	progress(RollbackStageCompleted, result)
 	return result, err
 }
 
-// watchRollbackEvent watches for rollback events and returns rollback result
-func watchRollbackEvent(w watch.Interface) string {
+// waitForRollout polls the named deployment until its status reports that the latest
+// template has been observed and all of its replicas are updated and available.
+func (r *DeploymentRollbacker) waitForRollout(namespace, name string) error {
+	timeout := r.timeout()
+	var deployment *extv1beta1.Deployment
+	err := wait.PollImmediate(Interval, timeout, func() (bool, error) {
+		var err error
+		deployment, err = r.c.ExtensionsV1beta1().Deployments(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if deployment.Generation > deployment.Status.ObservedGeneration {
+			return false, nil
+		}
+		cond := deploymentutil.GetDeploymentCondition(deployment.Status, extv1beta1.DeploymentProgressing)
+		if cond != nil && cond.Reason == deploymentutil.TimedOutReason {
+			return false, fmt.Errorf("deployment %q exceeded its progress deadline", name)
+		}
+		return deploymentutil.DeploymentComplete(deployment, &deployment.Status), nil
+	})
+	if err == wait.ErrWaitTimeout {
+		desired := int32(1)
+		if deployment.Spec.Replicas != nil {
+			desired = *deployment.Spec.Replicas
+		}
+		updated := deployment.Status.UpdatedReplicas
+		if deployment.Generation > deployment.Status.ObservedGeneration {
+			// The status does not reflect the rolled back template yet
+			updated = 0
+		}
+		return fmt.Errorf("timed out waiting for deployment %q rollback to complete: %d of %d replicas are updated, %d of %d are available",
+			name, updated, desired, deployment.Status.AvailableReplicas, desired)
+	}
+	return err
+}
+
+// deploymentRevisionTarget returns the live deployment named name in namespace, and its given revision and
+// the pod template of it. If toRevision is 0, the last previously used revision and its template are returned.
+func deploymentRevisionTarget(c kubernetes.Interface, namespace, name string, toRevision int64) (*extv1beta1.Deployment, int64, *v1.PodTemplateSpec, error) {
+	deployment, err := c.ExtensionsV1beta1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to retrieve deployment %s: %v", name, err)
+	}
+	revisionToRS, err := deploymentRevisions(deployment, c.ExtensionsV1beta1())
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	revision, template, err := deploymentRevisionTemplate(revisionToRS, toRevision)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return deployment, revision, template, nil
+}
+
+// pollRollback polls the deployment named name in namespace until the deployment controller has processed
+// its pending rollback, and returns the rollback result by comparing its template to the target template.
+// It is used to confirm a rollback when the rollback events can't be watched, and gives up at deadline.
+// The deployment is checked at least once, even if deadline has already passed.
+func (r *DeploymentRollbacker) pollRollback(namespace, name string, template *v1.PodTemplateSpec, deadline time.Time) (string, error) {
+	// A zero timeout would make the poll wait forever
+	timeout := deadline.Sub(time.Now())
+	if timeout <= 0 {
+		timeout = time.Nanosecond
+	}
+	var deployment *extv1beta1.Deployment
+	err := wait.PollImmediate(Interval, timeout, func() (bool, error) {
+		var err error
+		deployment, err = r.c.ExtensionsV1beta1().Deployments(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return deployment.Spec.RollbackTo == nil && deployment.Status.ObservedGeneration >= deployment.Generation, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return "", fmt.Errorf("rollback status unknown after %v: timed out waiting for deployment %q to be rolled back", r.timeout(), name)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !deploymentutil.EqualIgnoreHash(template, &deployment.Spec.Template) {
+		return fmt.Sprintf("%s (the deployment template does not match the target revision after the rollback)", rollbackSkipped), nil
+	}
+	return rollbackSuccess, nil
+}
+
+// watchRollbackEvent watches for rollback events and returns rollback result. onEvent, if not nil,
+// is called with the rollback event. If the watch ends or no rollback event is seen within timeout,
+// the result is empty and the rollback status has to be found otherwise. Being interrupted by a
+// signal is an error. The watch is always stopped on return.
+func watchRollbackEvent(w watch.Interface, timeout time.Duration, onEvent func(*v1.Event)) (string, error) {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, os.Kill, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	return waitRollbackEvent(w, timeout, signals, onEvent)
+}
+
+// waitRollbackEvent implements watchRollbackEvent, giving up on any signal received from signals.
+func waitRollbackEvent(w watch.Interface, timeout time.Duration, signals <-chan os.Signal, onEvent func(*v1.Event)) (string, error) {
+	defer w.Stop()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 	for {
 		select {
 		case event, ok := <-w.ResultChan():
 			if !ok {
-				return ""
+				return "", nil
 			}
-			obj, ok := event.Object.(*api.Event)
+			// Events are watched through the core/v1 client, anything else is not a rollback event
+			obj, ok := event.Object.(*v1.Event)
 			if !ok {
-				w.Stop()
-				return ""
+				continue
 			}
 			isRollback, result := isRollbackEvent(obj)
 			if isRollback {
-				w.Stop()
-				return result
+				if onEvent != nil {
+					onEvent(obj)
+				}
+				return result, nil
 			}
-		case <-signals:
-			w.Stop()
+		case sig := <-signals:
+			return "", fmt.Errorf("interrupted by %v while waiting for the rollback", sig)
+		case <-timer.C:
+			return "", nil
 		}
 	}
 }
 
 // isRollbackEvent checks if the input event is about rollback, and returns true and
 // related result string back if it is.
-func isRollbackEvent(e *api.Event) (bool, string) {
+func isRollbackEvent(e *v1.Event) (bool, string) {
 	rollbackEventReasons := []string{deploymentutil.RollbackRevisionNotFound, deploymentutil.RollbackTemplateUnchanged, deploymentutil.RollbackDone}
 	for _, reason := range rollbackEventReasons {
 		if e.Reason == reason {
@@ -151,99 +614,272 @@ func isRollbackEvent(e *api.Event) (bool, string) {
 	return false, ""
 }
 
-func simpleDryRun(deployment *extensions.Deployment, c kubernetes.Interface, toRevision int64) (string, error) {
-	externalDeployment := &extv1beta1.Deployment{}
-	if err := legacyscheme.Scheme.Convert(deployment, externalDeployment, nil); err != nil {
-		return "", fmt.Errorf("failed to convert deployment, %v", err)
+func simpleDryRun(deployment *extv1beta1.Deployment, c kubernetes.Interface, toRevision int64, opts RollbackerOptions) (string, error) {
+	revisionToRS, err := deploymentRevisions(deployment, c.ExtensionsV1beta1())
+	if err != nil {
+		return "", err
+	}
+	if len(revisionToRS) < 2 {
+		return "", &NoHistoryError{Kind: "deployment", Name: deployment.Name}
 	}
 
-	_, allOldRSs, newRS, err := deploymentutil.GetAllReplicaSets(externalDeployment, c.ExtensionsV1beta1())
+	revision, template, err := deploymentRevisionTemplate(revisionToRS, toRevision)
 	if err != nil {
-		return "", fmt.Errorf("failed to retrieve replica sets from deployment %s: %v", deployment.Name, err)
+		return "", err
 	}
-	allRSs := allOldRSs
-	if newRS != nil {
-		allRSs = append(allRSs, newRS)
+	if opts.DryRunDiff || len(opts.OutputFormat) > 0 {
+		return opts.printDryRun(revision, rollsForward(annotatedRevision(deployment), revision), &deployment.Spec.Template, template)
 	}
+	content, err := opts.templatePrinter().PrintTemplate(template)
+	if err != nil {
+		return "", err
+	}
+	content = dryRunSummary(revision, &deployment.Spec.Template, template) + content
+	if toRevision == 0 {
+		return "\n" + content, nil
+	}
+	return content, nil
+}
 
-	revisionToSpec := make(map[int64]*v1.PodTemplateSpec)
-	for _, rs := range allRSs {
-		v, err := deploymentutil.Revision(rs)
-		if err != nil {
-			continue
+// internalDeployment returns obj as an internal Deployment, converting extensions/v1beta1 and apps/v1beta1
+// Deployments.
+func internalDeployment(obj runtime.Object) (*extensions.Deployment, error) {
+	switch d := obj.(type) {
+	case *extensions.Deployment:
+		return d, nil
+	case *extv1beta1.Deployment, *appsv1beta1.Deployment:
+		internalDeployment := &extensions.Deployment{}
+		if err := legacyscheme.Scheme.Convert(obj, internalDeployment, nil); err != nil {
+			return nil, fmt.Errorf("failed to convert deployment, %v", err)
 		}
-		revisionToSpec[v] = &rs.Spec.Template
+		return internalDeployment, nil
+	}
+	return nil, fmt.Errorf("passed object is not a Deployment: %#v", obj)
+}
+
+// applyDeploymentRevision returns the revision a rollback of deployment to toRevision restores and a copy of
+// deployment with the pod template of that revision.
+func applyDeploymentRevision(deployment *extv1beta1.Deployment, c kubernetes.Interface, toRevision int64) (int64, *extv1beta1.Deployment, error) {
+	revisionToRS, err := deploymentRevisions(deployment, c.ExtensionsV1beta1())
+	if err != nil {
+		return 0, nil, err
 	}
+	if len(revisionToRS) < 2 {
+		return 0, nil, &NoHistoryError{Kind: "deployment", Name: deployment.Name}
+	}
+	revision, template, err := deploymentRevisionTemplate(revisionToRS, toRevision)
+	if err != nil {
+		return 0, nil, err
+	}
+	applied := deployment.DeepCopy()
+	template.DeepCopyInto(&applied.Spec.Template)
+	// The pod-template-hash label is added by the deployment controller to ReplicaSets only
+	delete(applied.Spec.Template.Labels, extv1beta1.DefaultDeploymentUniqueLabelKey)
+	return revision, applied, nil
+}
 
-	if len(revisionToSpec) < 2 {
-		return "", fmt.Errorf("no rollout history found for deployment %q", deployment.Name)
+type ReplicationControllerRollbacker struct {
+	c kubernetes.Interface
+	RollbackerOptions
+}
+
+// Rollback restores the pod template of a replication controller to the one of the replication controller
+// of the given revision in its history. toRevision 0 restores the last previously used revision.
+func (r *ReplicationControllerRollbacker) Rollback(obj runtime.Object, updatedAnnotations map[string]string, toRevision int64, dryRun bool) (string, error) {
+	return r.RollbackWithOptions(obj, RollbackOptions{UpdatedAnnotations: updatedAnnotations, ToRevision: toRevision, DryRun: dryRun})
+}
+
+// RollbackWithOptions rolls back obj as described by opts.
+func (r *ReplicationControllerRollbacker) RollbackWithOptions(obj runtime.Object, opts RollbackOptions) (string, error) {
+	if err := r.checkChangeCause(opts.UpdatedAnnotations); err != nil {
+		return "", err
+	}
+	if opts.DryRun && r.ServerDryRun {
+		return "", fmt.Errorf("server-side dry-run is not supported for ReplicationControllers")
+	}
+	if r.patchType() != types.StrategicMergePatchType {
+		return "", fmt.Errorf("patch type %q is not supported for ReplicationControllers, expected %s", r.PatchType, types.StrategicMergePatchType)
+	}
+	if opts.ToRevision < 0 {
+		return "", revisionNotFound(opts.ToRevision, nil)
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", fmt.Errorf("failed to create accessor for kind %v: %s", obj.GetObjectKind(), err.Error())
+	}
+	progress := r.progressOf(api.Kind("ReplicationController"), accessor)
+	rc, revisionToRC, err := replicationControllerRevisions(r.c.CoreV1(), accessor.GetNamespace(), accessor.GetName())
+	if err != nil {
+		return "", err
+	}
+	if err := checkSameObject(accessor, rc); err != nil {
+		return "", err
+	}
+	if opts.ToRevision == 0 && len(revisionToRC) <= 1 {
+		return "", &NoHistoryError{}
 	}
 
-	if toRevision > 0 {
-		template, ok := revisionToSpec[toRevision]
-		if !ok {
-			return "", revisionNotFoundErr(toRevision)
+	toRevision, toRC := findReplicationControllerRevision(opts.ToRevision, revisionToRC)
+	if toRC == nil {
+		revisions := make([]int64, 0, len(revisionToRC))
+		for r := range revisionToRC {
+			revisions = append(revisions, r)
 		}
-		buf := bytes.NewBuffer([]byte{})
-		internalTemplate := &api.PodTemplateSpec{}
-		if err := apiv1.Convert_v1_PodTemplateSpec_To_api_PodTemplateSpec(template, internalTemplate, nil); err != nil {
-			return "", fmt.Errorf("failed to convert podtemplate, %v", err)
+		return "", revisionNotFound(toRevision, revisions)
+	}
+	current := annotatedRevision(rc)
+	template := replicationControllerTemplate(rc, toRC.Spec.Template)
+
+	if opts.DryRun {
+		if r.DryRunManifest {
+			applied := rc.DeepCopy()
+			applied.Spec.Template = template
+			return printManifest(applied, v1.SchemeGroupVersion.WithKind("ReplicationController"), r.rollbackAnnotations(opts, current, toRevision))
 		}
-		w := printersinternal.NewPrefixWriter(buf)
-		printersinternal.DescribePodTemplate(internalTemplate, w)
-		return buf.String(), nil
+		return r.printDryRun(toRevision, rollsForward(current, toRevision), rc.Spec.Template, template)
 	}
 
-	// Sort the revisionToSpec map by revision
-	revisions := make([]int64, 0, len(revisionToSpec))
-	for r := range revisionToSpec {
-		revisions = append(revisions, r)
+	// Skip if the revision already matches current ReplicationController
+	if apiequality.Semantic.DeepEqual(rc.Spec.Template, template) {
+		result := fmt.Sprintf("%s (current template already matches revision %d)", rollbackSkipped, toRevision)
+		progress(RollbackStageSkipped, result)
+		return result, nil
 	}
-	sliceutil.SortInts64(revisions)
 
-	template, _ := revisionToSpec[revisions[len(revisions)-2]]
-	buf := bytes.NewBuffer([]byte{})
-	buf.WriteString("\n")
-	internalTemplate := &api.PodTemplateSpec{}
-	if err := apiv1.Convert_v1_PodTemplateSpec_To_api_PodTemplateSpec(template, internalTemplate, nil); err != nil {
-		return "", fmt.Errorf("failed to convert podtemplate, %v", err)
+	// Restore revision
+	patch, err := getReplicationControllerRollbackPatch(template, r.rollbackAnnotations(opts, current, toRevision))
+	if err != nil {
+		return "", fmt.Errorf("failed restoring revision %d: %v", toRevision, err)
+	}
+	if _, err = r.c.CoreV1().ReplicationControllers(rc.Namespace).Patch(rc.Name, types.StrategicMergePatchType, patch); err != nil {
+		return "", fmt.Errorf("failed restoring revision %d: %v", toRevision, err)
 	}
-	w := printersinternal.NewPrefixWriter(buf)
-	printersinternal.DescribePodTemplate(internalTemplate, w)
-	return buf.String(), nil
+	progress(RollbackStageSubmitted, "")
+	result := rollResult(rollbackSuccess, rollsForward(current, toRevision))
+	progress(RollbackStageCompleted, result)
+	return result, nil
+}
+
+// findReplicationControllerRevision returns the given revision and its replication controller from revisionToRC,
+// or a nil replication controller if there is no such revision. If toRevision is 0, the last previously used
+// revision is returned.
+func findReplicationControllerRevision(toRevision int64, revisionToRC map[int64]*v1.ReplicationController) (int64, *v1.ReplicationController) {
+	if toRevision == 0 {
+		revisions := make([]int64, 0, len(revisionToRC))
+		for r := range revisionToRC {
+			revisions = append(revisions, r)
+		}
+		if len(revisions) < 2 {
+			return toRevision, nil
+		}
+		sliceutil.SortInts64(revisions)
+		toRevision = revisions[len(revisions)-2]
+	}
+	return toRevision, revisionToRC[toRevision]
+}
+
+// replicationControllerTemplate returns a copy of template, the pod template of another revision of rc, with the
+// labels selected by rc set to the values rc selects. The replication controllers of a history commonly select
+// their pods by distinct labels, the pod template restored on rc must still match its selector.
+func replicationControllerTemplate(rc *v1.ReplicationController, template *v1.PodTemplateSpec) *v1.PodTemplateSpec {
+	template = template.DeepCopy()
+	if template.Labels == nil && len(rc.Spec.Selector) > 0 {
+		template.Labels = make(map[string]string, len(rc.Spec.Selector))
+	}
+	for k, v := range rc.Spec.Selector {
+		template.Labels[k] = v
+	}
+	return template
+}
+
+// getReplicationControllerRollbackPatch returns the strategic merge patch that replaces the pod template of a
+// replication controller with template, and records any updatedAnnotations.
+func getReplicationControllerRollbackPatch(template *v1.PodTemplateSpec, updatedAnnotations map[string]string) ([]byte, error) {
+	templateBytes, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	var templatePatch map[string]interface{}
+	if err := json.Unmarshal(templateBytes, &templatePatch); err != nil {
+		return nil, err
+	}
+	templatePatch["$patch"] = "replace"
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{"template": templatePatch},
+	}
+	if len(updatedAnnotations) > 0 {
+		patch["metadata"] = map[string]interface{}{"annotations": updatedAnnotations}
+	}
+	return json.Marshal(patch)
 }
 
 type DaemonSetRollbacker struct {
 	c kubernetes.Interface
+	RollbackerOptions
 }
 
 func (r *DaemonSetRollbacker) Rollback(obj runtime.Object, updatedAnnotations map[string]string, toRevision int64, dryRun bool) (string, error) {
-	if toRevision < 0 {
-		return "", revisionNotFoundErr(toRevision)
+	return r.RollbackWithOptions(obj, RollbackOptions{UpdatedAnnotations: updatedAnnotations, ToRevision: toRevision, DryRun: dryRun})
+}
+
+// RollbackWithOptions rolls back obj as described by opts.
+func (r *DaemonSetRollbacker) RollbackWithOptions(obj runtime.Object, opts RollbackOptions) (string, error) {
+	if err := r.checkChangeCause(opts.UpdatedAnnotations); err != nil {
+		return "", err
+	}
+	if opts.ToRevision < 0 {
+		return "", revisionNotFound(opts.ToRevision, nil)
 	}
 	accessor, err := meta.Accessor(obj)
 	if err != nil {
 		return "", fmt.Errorf("failed to create accessor for kind %v: %s", obj.GetObjectKind(), err.Error())
 	}
+	progress := r.progressOf(extensions.Kind("DaemonSet"), accessor)
 	ds, history, err := daemonSetHistory(r.c.ExtensionsV1beta1(), r.c.AppsV1beta1(), accessor.GetNamespace(), accessor.GetName())
 	if err != nil {
 		return "", err
 	}
-	if toRevision == 0 && len(history) <= 1 {
-		return "", fmt.Errorf("no last revision to roll back to")
+	if err := checkSameObject(accessor, ds); err != nil {
+		return "", err
+	}
+	if opts.ToRevision == 0 && len(history) <= 1 {
+		return "", &NoHistoryError{}
 	}
 
-	toHistory := findHistory(toRevision, history)
+	toHistory := FindHistory(opts.ToRevision, history)
 	if toHistory == nil {
-		return "", revisionNotFoundErr(toRevision)
+		return "", revisionNotFound(opts.ToRevision, historyRevisionNumbers(history))
 	}
+	current, err := matchingRevision(history, func(h *appsv1beta1.ControllerRevision) (bool, error) { return daemon.Match(ds, h) })
+	if err != nil {
+		return "", err
+	}
+	forward := rollsForward(current, toHistory.Revision)
+	annotations := r.rollbackAnnotations(opts, current, toHistory.Revision)
 
-	if dryRun {
+	if opts.DryRun {
+		if r.ServerDryRun && serverSupportsDryRun(r.c) {
+			patch, err := r.daemonSetRollbackPatch(ds, toHistory, annotations)
+			if err != nil {
+				return "", fmt.Errorf("failed restoring revision %d: %v", opts.ToRevision, err)
+			}
+			appliedDS := &extv1beta1.DaemonSet{}
+			if err := serverDryRunPatch(r.c.ExtensionsV1beta1().RESTClient(), ds.Namespace, "daemonsets", ds.Name, r.patchType(), patch, appliedDS); err != nil {
+				return "", fmt.Errorf("failed dry-run restoring revision %d: %v", opts.ToRevision, err)
+			}
+			if r.DryRunManifest {
+				return printManifest(appliedDS, extv1beta1.SchemeGroupVersion.WithKind("DaemonSet"), nil)
+			}
+			return r.printDryRun(toHistory.Revision, forward, &ds.Spec.Template, &appliedDS.Spec.Template)
+		}
 		appliedDS, err := applyDaemonSetHistory(ds, toHistory)
 		if err != nil {
 			return "", err
 		}
-		return printPodTemplate(&appliedDS.Spec.Template)
+		if r.DryRunManifest {
+			return printManifest(appliedDS, extv1beta1.SchemeGroupVersion.WithKind("DaemonSet"), annotations)
+		}
+		return r.printDryRun(toHistory.Revision, forward, &ds.Spec.Template, &appliedDS.Spec.Template)
 	}
 
 	// Skip if the revision already matches current DaemonSet
@@ -252,49 +888,147 @@ func (r *DaemonSetRollbacker) Rollback(obj runtime.Object, updatedAnnotations ma
 		return "", err
 	}
 	if done {
-		return fmt.Sprintf("%s (current template already matches revision %d)", rollbackSkipped, toRevision), nil
+		result := fmt.Sprintf("%s (current template already matches revision %d)", rollbackSkipped, toHistory.Revision)
+		progress(RollbackStageSkipped, result)
+		return result, nil
 	}
 
 	// Restore revision
-	if _, err = r.c.ExtensionsV1beta1().DaemonSets(accessor.GetNamespace()).Patch(accessor.GetName(), types.StrategicMergePatchType, toHistory.Data.Raw); err != nil {
-		return "", fmt.Errorf("failed restoring revision %d: %v", toRevision, err)
+	patch, err := r.daemonSetRollbackPatch(ds, toHistory, annotations)
+	if err != nil {
+		return "", fmt.Errorf("failed restoring revision %d: %v", opts.ToRevision, err)
+	}
+	if _, err = r.c.ExtensionsV1beta1().DaemonSets(accessor.GetNamespace()).Patch(accessor.GetName(), r.patchType(), patch); err != nil {
+		return "", fmt.Errorf("failed restoring revision %d: %v", opts.ToRevision, err)
 	}
+	progress(RollbackStageSubmitted, "")
 
-	return rollbackSuccess, nil
+	result := rollResult(rollbackSuccess, forward)
+	if ds.Spec.UpdateStrategy.Type == extv1beta1.OnDeleteDaemonSetStrategyType {
+		result = rollResult(rollbackOnDelete, forward)
+	} else if r.WaitForRollout {
+		if err := r.waitForRollout(ds.Namespace, ds.Name); err != nil {
+			return "", err
+		}
+	}
+	progress(RollbackStageCompleted, result)
+	return result, nil
+}
+
+// waitForRollout polls the named daemon set until its status reports that the latest template
+// has been observed and scheduled, updated and available on every node it should run on.
+func (r *DaemonSetRollbacker) waitForRollout(namespace, name string) error {
+	timeout := r.timeout()
+	var ds *extv1beta1.DaemonSet
+	err := wait.PollImmediate(Interval, timeout, func() (bool, error) {
+		var err error
+		ds, err = r.c.ExtensionsV1beta1().DaemonSets(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if ds.Generation > ds.Status.ObservedGeneration {
+			return false, nil
+		}
+		return ds.Status.UpdatedNumberScheduled >= ds.Status.DesiredNumberScheduled &&
+			ds.Status.NumberAvailable >= ds.Status.DesiredNumberScheduled, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		done := ds.Status.UpdatedNumberScheduled
+		if ds.Status.NumberAvailable < done {
+			done = ds.Status.NumberAvailable
+		}
+		pending := ds.Status.DesiredNumberScheduled - done
+		if ds.Generation > ds.Status.ObservedGeneration {
+			// The status does not reflect the rolled back template yet
+			pending = ds.Status.DesiredNumberScheduled
+		}
+		return fmt.Errorf("timed out waiting for DaemonSet %q rollback to complete: %d of %d nodes are still pending",
+			name, pending, ds.Status.DesiredNumberScheduled)
+	}
+	return err
+}
+
+// daemonSetRollbackPatch returns the patch of the configured PatchType restoring history on ds.
+func (r *DaemonSetRollbacker) daemonSetRollbackPatch(ds *extv1beta1.DaemonSet, history *appsv1beta1.ControllerRevision, updatedAnnotations map[string]string) ([]byte, error) {
+	if r.patchType() != types.MergePatchType {
+		return getRollbackPatch(history, updatedAnnotations)
+	}
+	appliedDS, err := applyDaemonSetHistory(ds, history)
+	if err != nil {
+		return nil, err
+	}
+	return getMergeRollbackPatch(ds, appliedDS, updatedAnnotations)
 }
 
 type StatefulSetRollbacker struct {
 	c kubernetes.Interface
+	RollbackerOptions
 }
 
 // toRevision is a non-negative integer, with 0 being reserved to indicate rolling back to previous configuration
 func (r *StatefulSetRollbacker) Rollback(obj runtime.Object, updatedAnnotations map[string]string, toRevision int64, dryRun bool) (string, error) {
-	if toRevision < 0 {
-		return "", revisionNotFoundErr(toRevision)
+	return r.RollbackWithOptions(obj, RollbackOptions{UpdatedAnnotations: updatedAnnotations, ToRevision: toRevision, DryRun: dryRun})
+}
+
+// RollbackWithOptions rolls back obj as described by opts.
+func (r *StatefulSetRollbacker) RollbackWithOptions(obj runtime.Object, opts RollbackOptions) (string, error) {
+	if err := r.checkChangeCause(opts.UpdatedAnnotations); err != nil {
+		return "", err
+	}
+	if opts.ToRevision < 0 {
+		return "", revisionNotFound(opts.ToRevision, nil)
 	}
 	accessor, err := meta.Accessor(obj)
 	if err != nil {
 		return "", fmt.Errorf("failed to create accessor for kind %v: %s", obj.GetObjectKind(), err.Error())
 	}
+	progress := r.progressOf(apps.Kind("StatefulSet"), accessor)
 	sts, history, err := statefulSetHistory(r.c.AppsV1beta1(), accessor.GetNamespace(), accessor.GetName())
 	if err != nil {
 		return "", err
 	}
-	if toRevision == 0 && len(history) <= 1 {
-		return "", fmt.Errorf("no last revision to roll back to")
+	if err := checkSameObject(accessor, sts); err != nil {
+		return "", err
+	}
+	if opts.ToRevision == 0 && len(history) <= 1 {
+		return "", &NoHistoryError{}
 	}
 
-	toHistory := findHistory(toRevision, history)
+	toHistory := FindHistory(opts.ToRevision, history)
 	if toHistory == nil {
-		return "", revisionNotFoundErr(toRevision)
+		return "", revisionNotFound(opts.ToRevision, historyRevisionNumbers(history))
+	}
+	current, err := matchingRevision(history, func(h *appsv1beta1.ControllerRevision) (bool, error) { return statefulset.Match(sts, h) })
+	if err != nil {
+		return "", err
 	}
+	forward := rollsForward(current, toHistory.Revision)
+	annotations := r.rollbackAnnotations(opts, current, toHistory.Revision)
 
-	if dryRun {
+	partition := statefulSetPartition(sts)
+	if opts.DryRun {
+		if r.ServerDryRun && serverSupportsDryRun(r.c) {
+			patch, err := r.statefulSetRollbackPatch(sts, toHistory, annotations, partition)
+			if err != nil {
+				return "", fmt.Errorf("failed restoring revision %d: %v", opts.ToRevision, err)
+			}
+			appliedSS := &appsv1beta1.StatefulSet{}
+			if err := serverDryRunPatch(r.c.AppsV1beta1().RESTClient(), sts.Namespace, "statefulsets", sts.Name, r.patchType(), patch, appliedSS); err != nil {
+				return "", fmt.Errorf("failed dry-run restoring revision %d: %v", opts.ToRevision, err)
+			}
+			if r.DryRunManifest {
+				return printManifest(appliedSS, appsv1beta1.SchemeGroupVersion.WithKind("StatefulSet"), nil)
+			}
+			return r.printDryRun(toHistory.Revision, forward, &sts.Spec.Template, &appliedSS.Spec.Template)
+		}
 		appliedSS, err := statefulset.ApplyRevision(sts, toHistory)
 		if err != nil {
 			return "", err
 		}
-		return printPodTemplate(&appliedSS.Spec.Template)
+		if r.DryRunManifest {
+			return printManifest(appliedSS, appsv1beta1.SchemeGroupVersion.WithKind("StatefulSet"), annotations)
+		}
+		return r.printDryRun(toHistory.Revision, forward, &sts.Spec.Template, &appliedSS.Spec.Template)
 	}
 
 	// Skip if the revision already matches current StatefulSet
@@ -303,64 +1037,731 @@ func (r *StatefulSetRollbacker) Rollback(obj runtime.Object, updatedAnnotations
 		return "", err
 	}
 	if done {
-		return fmt.Sprintf("%s (current template already matches revision %d)", rollbackSkipped, toRevision), nil
+		result := fmt.Sprintf("%s (current template already matches revision %d)", rollbackSkipped, toHistory.Revision)
+		progress(RollbackStageSkipped, result)
+		return result, nil
 	}
 
 	// Restore revision
-	if _, err = r.c.AppsV1beta1().StatefulSets(sts.Namespace).Patch(sts.Name, types.StrategicMergePatchType, toHistory.Data.Raw); err != nil {
-		return "", fmt.Errorf("failed restoring revision %d: %v", toRevision, err)
+	patch, err := r.statefulSetRollbackPatch(sts, toHistory, annotations, partition)
+	if err != nil {
+		return "", fmt.Errorf("failed restoring revision %d: %v", opts.ToRevision, err)
 	}
+	if _, err = r.c.AppsV1beta1().StatefulSets(sts.Namespace).Patch(sts.Name, r.patchType(), patch); err != nil {
+		return "", fmt.Errorf("failed restoring revision %d: %v", opts.ToRevision, err)
+	}
+	progress(RollbackStageSubmitted, "")
 
-	return rollbackSuccess, nil
+	result := rollResult(rollbackSuccess, forward)
+	if sts.Spec.UpdateStrategy.Type == appsv1beta1.OnDeleteStatefulSetStrategyType {
+		result = rollResult(rollbackOnDelete, forward)
+	} else if partition > 0 && !r.ClearPartition {
+		result = fmt.Sprintf("%s (%s)", result, partitionWarning(sts, partition))
+	}
+	progress(RollbackStageCompleted, result)
+	return result, nil
+}
+
+// statefulSetRollbackPatch returns the patch of the configured PatchType restoring history on sts. If
+// ClearPartition is set and the StatefulSet has a non-zero partition, the patch also resets the partition to 0.
+func (r *StatefulSetRollbacker) statefulSetRollbackPatch(sts *appsv1beta1.StatefulSet, history *appsv1beta1.ControllerRevision, updatedAnnotations map[string]string, partition int32) ([]byte, error) {
+	if r.patchType() == types.MergePatchType {
+		appliedSS, err := statefulset.ApplyRevision(sts, history)
+		if err != nil {
+			return nil, err
+		}
+		if partition > 0 && r.ClearPartition {
+			appliedSS.Spec.UpdateStrategy.RollingUpdate.Partition = new(int32)
+		}
+		return getMergeRollbackPatch(sts, appliedSS, updatedAnnotations)
+	}
+	patch, err := getRollbackPatch(history, updatedAnnotations)
+	if err != nil || partition == 0 || !r.ClearPartition {
+		return patch, err
+	}
+	var patchMap map[string]interface{}
+	if err := json.Unmarshal(patch, &patchMap); err != nil {
+		return nil, err
+	}
+	spec, ok := patchMap["spec"].(map[string]interface{})
+	if !ok {
+		spec = map[string]interface{}{}
+		patchMap["spec"] = spec
+	}
+	spec["updateStrategy"] = map[string]interface{}{
+		"rollingUpdate": map[string]interface{}{"partition": 0},
+	}
+	return json.Marshal(patchMap)
 }
 
-// findHistory returns a controllerrevision of a specific revision from the given controllerrevisions.
+// statefulSetPartition returns the rolling update partition of sts, or 0 if it has none.
+func statefulSetPartition(sts *appsv1beta1.StatefulSet) int32 {
+	if sts.Spec.UpdateStrategy.Type != appsv1beta1.RollingUpdateStatefulSetStrategyType ||
+		sts.Spec.UpdateStrategy.RollingUpdate == nil ||
+		sts.Spec.UpdateStrategy.RollingUpdate.Partition == nil {
+		return 0
+	}
+	return *sts.Spec.UpdateStrategy.RollingUpdate.Partition
+}
+
+// partitionWarning describes which pods of sts a rollback reverts given its non-zero partition.
+func partitionWarning(sts *appsv1beta1.StatefulSet, partition int32) string {
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	if partition >= replicas {
+		return fmt.Sprintf("partition is %d: no pods will be reverted until the partition is lowered", partition)
+	}
+	return fmt.Sprintf("partition is %d: only pods with ordinal %d or higher will be reverted, pods with a lower ordinal keep their current revision",
+		partition, partition)
+}
+
+// FindHistory returns a controllerrevision of a specific revision from the given controllerrevisions.
 // It returns nil if no such controllerrevision exists.
-// If toRevision is 0, the last previously used history is returned.
-func findHistory(toRevision int64, allHistory []*appsv1beta1.ControllerRevision) *appsv1beta1.ControllerRevision {
+// If toRevision is 0, the last previously used history is returned. allHistory may be sorted in place.
+// After a hash collision more than one controllerrevision may have the same revision, the most recently
+// created one is returned then, ties being broken by name.
+func FindHistory(toRevision int64, allHistory []*appsv1beta1.ControllerRevision) *appsv1beta1.ControllerRevision {
 	if toRevision == 0 && len(allHistory) <= 1 {
 		return nil
 	}
 
-	// Find the history to rollback to
-	var toHistory *appsv1beta1.ControllerRevision
 	if toRevision == 0 {
-		// If toRevision == 0, find the latest revision (2nd max)
-		sort.Sort(historiesByRevision(allHistory))
-		toHistory = allHistory[len(allHistory)-2]
-	} else {
-		for _, h := range allHistory {
-			if h.Revision == toRevision {
-				// If toRevision != 0, find the history with matching revision
-				return h
+		// If toRevision == 0, find the latest revision (2nd max), skipping any collision on the max
+		sort.Sort(HistoriesByRevision(allHistory))
+		current := allHistory[len(allHistory)-1].Revision
+		for i := len(allHistory) - 2; i >= 0 && toRevision == 0; i-- {
+			if allHistory[i].Revision < current {
+				toRevision = allHistory[i].Revision
 			}
 		}
+		if toRevision == 0 {
+			return nil
+		}
 	}
 
+	// Find the history to rollback to
+	var toHistory *appsv1beta1.ControllerRevision
+	for _, h := range allHistory {
+		if h.Revision == toRevision && (toHistory == nil || newerHistory(h, toHistory)) {
+			toHistory = h
+		}
+	}
 	return toHistory
 }
 
+// getRollbackPatch returns the strategic merge patch that restores the given controllerrevision.
+// Any updatedAnnotations are merged into the patch so they are recorded on the rolled back object.
+func getRollbackPatch(history *appsv1beta1.ControllerRevision, updatedAnnotations map[string]string) ([]byte, error) {
+	if len(updatedAnnotations) == 0 {
+		return history.Data.Raw, nil
+	}
+	var patch map[string]interface{}
+	if err := json.Unmarshal(history.Data.Raw, &patch); err != nil {
+		return nil, err
+	}
+	patch["metadata"] = map[string]interface{}{"annotations": updatedAnnotations}
+	return json.Marshal(patch)
+}
+
+// getMergeRollbackPatch returns the JSON merge patch turning live into target, with any updatedAnnotations
+// recorded on target. target is modified.
+func getMergeRollbackPatch(live, target runtime.Object, updatedAnnotations map[string]string) ([]byte, error) {
+	if len(updatedAnnotations) > 0 {
+		accessor, err := meta.Accessor(target)
+		if err != nil {
+			return nil, err
+		}
+		annotations := accessor.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		for k, v := range updatedAnnotations {
+			annotations[k] = v
+		}
+		accessor.SetAnnotations(annotations)
+	}
+	liveBytes, err := json.Marshal(live)
+	if err != nil {
+		return nil, err
+	}
+	targetBytes, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.CreateMergePatch(liveBytes, targetBytes)
+}
+
+// serverSupportsDryRun returns true if the API server c talks to is recent enough to support dry-run requests.
+func serverSupportsDryRun(c kubernetes.Interface) bool {
+	info, err := c.Discovery().ServerVersion()
+	if err != nil {
+		return false
+	}
+	serverVersion, err := utilversion.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return false
+	}
+	return serverVersion.AtLeast(serverDryRunVersion)
+}
+
+// serverDryRunPatch sends patch for the named resource to the API server in dry-run mode and decodes
+// the object the server would have persisted into result.
+func serverDryRunPatch(client rest.Interface, namespace, resource, name string, pt types.PatchType, patch []byte, result runtime.Object) error {
+	return client.Patch(pt).
+		Namespace(namespace).
+		Resource(resource).
+		Name(name).
+		Param("dryRun", dryRunAll).
+		Body(patch).
+		Do().
+		Into(result)
+}
+
+// deploymentTemplatePatchDryRun asks the API server what deployment would be after rolling it back to
+// toRevision, without persisting anything. The rollback subresource does not support dry-runs and returns
+// no object, so the revision is resolved here and a patch replacing the pod template with the one of the
+// revision is dry-run instead. The server validates the resulting deployment, but not the rollback itself:
+// it is up to the caller to refuse paused deployments and to record annotations. It returns the revision
+// rolled back to and the resulting deployment.
+func deploymentTemplatePatchDryRun(c kubernetes.Interface, deployment *extv1beta1.Deployment, toRevision int64) (int64, *extv1beta1.Deployment, error) {
+	revisionToRS, err := deploymentRevisions(deployment, c.ExtensionsV1beta1())
+	if err != nil {
+		return 0, nil, err
+	}
+	revision, template, err := deploymentRevisionTemplate(revisionToRS, toRevision)
+	if err != nil {
+		return 0, nil, err
+	}
+	// The pod-template-hash label is added by the deployment controller to ReplicaSets only
+	template = template.DeepCopy()
+	delete(template.Labels, extv1beta1.DefaultDeploymentUniqueLabelKey)
+	patch, err := json.Marshal([]interface{}{
+		map[string]interface{}{"op": "replace", "path": "/spec/template", "value": template},
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	result := &extv1beta1.Deployment{}
+	if err := serverDryRunPatch(c.ExtensionsV1beta1().RESTClient(), deployment.Namespace, "deployments", deployment.Name, types.JSONPatchType, patch, result); err != nil {
+		return 0, nil, fmt.Errorf("failed dry-run rolling back deployment %s: %v", deployment.Name, err)
+	}
+	return revision, result, nil
+}
+
+// serverManagedMetadata lists the metadata fields set by the API server, which printManifest removes.
+var serverManagedMetadata = []string{"uid", "selfLink", "resourceVersion", "generation", "creationTimestamp", "managedFields"}
+
+// printManifest serializes obj, an object at the revision a dry-run would restore, as a YAML manifest of
+// the given kind that can be applied as is. annotations are added to its metadata, and its status and
+// server-managed metadata are removed.
+func printManifest(obj runtime.Object, gvk schema.GroupVersionKind, annotations map[string]string) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	manifest := map[string]interface{}{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", err
+	}
+	// Objects returned by typed clients carry no type information
+	manifest["apiVersion"] = gvk.GroupVersion().String()
+	manifest["kind"] = gvk.Kind
+	delete(manifest, "status")
+	metadata, ok := manifest["metadata"].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("%s has no metadata", gvk.Kind)
+	}
+	for _, field := range serverManagedMetadata {
+		delete(metadata, field)
+	}
+	if len(annotations) > 0 {
+		merged, _ := metadata["annotations"].(map[string]interface{})
+		if merged == nil {
+			merged = make(map[string]interface{}, len(annotations))
+			metadata["annotations"] = merged
+		}
+		for k, v := range annotations {
+			merged[k] = v
+		}
+	}
+	content, err := yaml.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
 // printPodTemplate converts a given pod template into a human-readable string.
-func printPodTemplate(specTemplate *v1.PodTemplateSpec) (string, error) {
-	content := bytes.NewBuffer([]byte{})
-	w := printersinternal.NewPrefixWriter(content)
-	internalTemplate := &api.PodTemplateSpec{}
-	if err := apiv1.Convert_v1_PodTemplateSpec_To_api_PodTemplateSpec(specTemplate, internalTemplate, nil); err != nil {
-		return "", fmt.Errorf("failed to convert podtemplate while printing: %v", err)
+func printPodTemplate(printer TemplatePrinter, specTemplate *v1.PodTemplateSpec, forward bool) (string, error) {
+	content, err := printer.PrintTemplate(specTemplate)
+	if err != nil {
+		return "", err
+	}
+	if forward {
+		return fmt.Sprintf("will roll forward to %s", content), nil
+	}
+	return fmt.Sprintf("will roll back to %s", content), nil
+}
+
+// rollsForward returns whether revision is newer than current, the current revision of the rolled back
+// object. Revisions start at 1, a current revision below that is unknown and never rolls forward.
+func rollsForward(current, revision int64) bool {
+	return current > 0 && revision > current
+}
+
+// annotatedRevision returns the revision recorded in the revision annotation of obj, or 0 if it has none.
+func annotatedRevision(obj runtime.Object) int64 {
+	current, err := deploymentutil.Revision(obj)
+	if err != nil {
+		return 0
+	}
+	return current
+}
+
+// rollResult returns result, the result of a rollback, worded as a roll forward if forward is set.
+func rollResult(result string, forward bool) string {
+	if !forward {
+		return result
+	}
+	switch result {
+	case rollbackSuccess:
+		return rollforwardSuccess
+	case rollbackOnDelete:
+		return rollforwardOnDelete
+	}
+	return result
+}
+
+// templateChange is a pod template field that differs between the live pod template and
+// the pod template of the revision to roll back to.
+type templateChange struct {
+	Path   string `json:"path"`
+	Live   string `json:"live,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// diffPodTemplates returns the fields that differ between the live and target pod templates, sorted
+// by path. The pod-template-hash label is ignored, as are empty fields.
+func diffPodTemplates(live, target *v1.PodTemplateSpec) ([]templateChange, error) {
+	liveFields, err := templateFields(live)
+	if err != nil {
+		return nil, err
+	}
+	targetFields, err := templateFields(target)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for path, value := range liveFields {
+		if targetFields[path] != value {
+			paths = append(paths, path)
+		}
+	}
+	for path := range targetFields {
+		if _, ok := liveFields[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	changes := []templateChange{}
+	for _, path := range paths {
+		changes = append(changes, templateChange{Path: path, Live: liveFields[path], Target: targetFields[path]})
+	}
+	return changes, nil
+}
+
+// templateFields flattens template into a map from the path of each of its non-empty leaf fields,
+// such as "spec.containers[0].image", to the JSON encoding of the field value.
+func templateFields(template *v1.PodTemplateSpec) (map[string]string, error) {
+	template = template.DeepCopy()
+	delete(template.Labels, extv1beta1.DefaultDeploymentUniqueLabelKey)
+	data, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	fields := map[string]string{}
+	if err := flattenFields("", value, fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func flattenFields(path string, value interface{}, fields map[string]string) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			fieldPath := key
+			if len(path) > 0 {
+				fieldPath = path + "." + key
+			}
+			if err := flattenFields(fieldPath, field, fields); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if err := flattenFields(fmt.Sprintf("%s[%d]", path, i), item, fields); err != nil {
+				return err
+			}
+		}
+	case nil:
+		// Unset fields are left out, like empty ones
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fields[path] = string(data)
+	}
+	return nil
+}
+
+// printTemplateChanges renders the pod template changes of a rollback, either in the given structured
+// output format or as a human-readable list.
+func printTemplateChanges(changes []templateChange, format string) (string, error) {
+	if len(format) > 0 {
+		return printStructured(changes, format)
+	}
+	if len(changes) == 0 {
+		return "will not change the pod template\n", nil
+	}
+	return tabbedString(func(out io.Writer) error {
+		fmt.Fprintf(out, "will change the pod template:\n")
+		for _, change := range changes {
+			fmt.Fprintf(out, "  %s:\t%s\t->\t%s\n", change.Path, valueOrNone(change.Live), valueOrNone(change.Target))
+		}
+		return nil
+	})
+}
+
+// valueOrNone returns value, or "<none>" if it is empty.
+func valueOrNone(value string) string {
+	if len(value) == 0 {
+		return "<none>"
+	}
+	return value
+}
+
+// dryRunSummary returns a one-line summary of rolling the live pod template back to the template of revision:
+// the number of containers whose image changes, the number of changed env vars and whether container
+// resources change. Rollbacks never change the number of replicas.
+func dryRunSummary(revision int64, live, template *v1.PodTemplateSpec) string {
+	liveContainers := map[string]v1.Container{}
+	for _, container := range templateContainers(live) {
+		liveContainers[container.Name] = container
+	}
+	images, envVars, resources := 0, 0, false
+	for _, container := range templateContainers(template) {
+		liveContainer, found := liveContainers[container.Name]
+		delete(liveContainers, container.Name)
+		if !found || liveContainer.Image != container.Image {
+			images++
+		}
+		if !apiequality.Semantic.DeepEqual(liveContainer.Resources, container.Resources) {
+			resources = true
+		}
+		envVars += countEnvChanges(liveContainer.Env, container.Env)
+	}
+	for _, liveContainer := range liveContainers {
+		envVars += len(liveContainer.Env)
+		if !apiequality.Semantic.DeepEqual(liveContainer.Resources, v1.ResourceRequirements{}) {
+			resources = true
+		}
+	}
+
+	changes := []string{}
+	if images > 0 {
+		changes = append(changes, pluralize(images, "container image"))
+	}
+	if envVars > 0 {
+		changes = append(changes, pluralize(envVars, "env var"))
+	}
+	if resources {
+		changes = append(changes, "resources")
+	}
+	switch len(changes) {
+	case 0:
+		return fmt.Sprintf("summary: revision %d changes no container images, env vars or resources\n", revision)
+	case 1:
+		return fmt.Sprintf("summary: revision %d changes %s\n", revision, changes[0])
 	}
-	printersinternal.DescribePodTemplate(internalTemplate, w)
-	return fmt.Sprintf("will roll back to %s", content.String()), nil
+	last := len(changes) - 1
+	return fmt.Sprintf("summary: revision %d changes %s and %s\n", revision, strings.Join(changes[:last], ", "), changes[last])
+}
+
+// templateContainers returns the init containers and containers of template.
+func templateContainers(template *v1.PodTemplateSpec) []v1.Container {
+	containers := make([]v1.Container, 0, len(template.Spec.InitContainers)+len(template.Spec.Containers))
+	containers = append(containers, template.Spec.InitContainers...)
+	return append(containers, template.Spec.Containers...)
+}
+
+// countEnvChanges returns the number of env vars added, removed or changed between live and target.
+func countEnvChanges(live, target []v1.EnvVar) int {
+	liveEnv := map[string]v1.EnvVar{}
+	for _, env := range live {
+		liveEnv[env.Name] = env
+	}
+	changed := 0
+	for _, env := range target {
+		liveVar, found := liveEnv[env.Name]
+		delete(liveEnv, env.Name)
+		if !found || !apiequality.Semantic.DeepEqual(liveVar, env) {
+			changed++
+		}
+	}
+	return changed + len(liveEnv)
+}
+
+// pluralize returns count followed by noun, with an "s" appended to noun unless count is 1.
+func pluralize(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, noun)
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+// checkSameObject returns an error if live, as retrieved for a rollback, is not the object passed in as obj
+// but a different object with the same name, for example because obj was deleted and recreated since it
+// was retrieved. Objects without a UID are not checked.
+func checkSameObject(obj, live metav1.Object) error {
+	if len(obj.GetUID()) == 0 || obj.GetUID() == live.GetUID() {
+		return nil
+	}
+	return fmt.Errorf("%s/%s has been replaced since it was retrieved (UID %s, now %s), retrieve it again before rolling it back",
+		obj.GetNamespace(), obj.GetName(), obj.GetUID(), live.GetUID())
+}
+
+// RevisionNotFoundError is returned when a revision is not in the history of the object it is requested of.
+type RevisionNotFoundError struct {
+	Revision int64
+	// Available lists the revisions in the history, if they are known.
+	Available []int64
+}
+
+func (e *RevisionNotFoundError) Error() string {
+	if e.Available == nil {
+		return fmt.Sprintf("unable to find specified revision %v in history", e.Revision)
+	}
+	return fmt.Sprintf("unable to find specified revision %v in history (available revisions: %s)", e.Revision, formatRevisions(e.Available))
+}
+
+// NoHistoryError is returned when rolling back to the previous revision of an object that has none.
+type NoHistoryError struct {
+	// Kind and Name are set when the object has no rollout history at all.
+	Kind string
+	Name string
+}
+
+func (e *NoHistoryError) Error() string {
+	if len(e.Name) > 0 {
+		return fmt.Sprintf("no rollout history found for %s %q", e.Kind, e.Name)
+	}
+	return "no last revision to roll back to"
+}
+
+// PausedError is returned when rolling back a paused Deployment.
+type PausedError struct {
+	Name string
+}
+
+func (e *PausedError) Error() string {
+	return fmt.Sprintf("you cannot rollback a paused deployment; resume it first with 'kubectl rollout resume deployment/%s' and try again", e.Name)
+}
+
+// UnsupportedKindError is returned when an operation, such as "rollbacker" or "history viewer", has not
+// been implemented for a kind.
+type UnsupportedKindError struct {
+	Kind      schema.GroupKind
+	Operation string
 }
 
-func revisionNotFoundErr(r int64) error {
-	return fmt.Errorf("unable to find specified revision %v in history", r)
+func (e *UnsupportedKindError) Error() string {
+	return fmt.Sprintf("no %s has been implemented for %q", e.Operation, e.Kind)
 }
 
+// HistoriesByRevision sorts controllerrevisions by ascending revision.
 // TODO: copied from daemon controller, should extract to a library
-type historiesByRevision []*appsv1beta1.ControllerRevision
+type HistoriesByRevision []*appsv1beta1.ControllerRevision
 
-func (h historiesByRevision) Len() int      { return len(h) }
-func (h historiesByRevision) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
-func (h historiesByRevision) Less(i, j int) bool {
+func (h HistoriesByRevision) Len() int      { return len(h) }
+func (h HistoriesByRevision) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h HistoriesByRevision) Less(i, j int) bool {
 	return h[i].Revision < h[j].Revision
 }
+
+// RollbackTarget names a resource to roll back with BatchRollback.
+type RollbackTarget struct {
+	Kind      schema.GroupKind
+	Namespace string
+	Name      string
+	// ToRevision is the revision to roll back to, 0 means the last previously used revision.
+	ToRevision int64
+}
+
+// RollbackResult is the outcome of rolling back a single RollbackTarget.
+type RollbackResult struct {
+	Target RollbackTarget
+	// Result is the message returned by the Rollbacker, such as "rolled back".
+	Result string
+	// Err is set if the target could not be rolled back.
+	Err error
+}
+
+// BatchRollbackOptions holds the optional settings of BatchRollbackWithOptions.
+type BatchRollbackOptions struct {
+	RollbackerOptions
+	// Workers is the number of targets rolled back concurrently. Values below 2 roll
+	// the targets back one at a time.
+	Workers int
+	// DryRun reports what each target would be rolled back to without changing it.
+	DryRun bool
+}
+
+// BatchRollback rolls back each of targets in order, and returns one result per target.
+func BatchRollback(c kubernetes.Interface, targets []RollbackTarget) ([]RollbackResult, error) {
+	return BatchRollbackWithOptions(c, targets, BatchRollbackOptions{})
+}
+
+// BatchRollbackWithOptions rolls back each of targets and returns one result per target, in the
+// order of targets. A failure to roll back one target does not stop the others; it is recorded in
+// the Err of its result instead. The returned error is only set if the batch could not be started.
+func BatchRollbackWithOptions(c kubernetes.Interface, targets []RollbackTarget, opts BatchRollbackOptions) ([]RollbackResult, error) {
+	if err := validateOutputFormat(opts.OutputFormat); err != nil {
+		return nil, err
+	}
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(targets) {
+		workers = len(targets)
+	}
+
+	results := make([]RollbackResult, len(targets))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = rollbackTarget(c, targets[i], opts)
+			}
+		}()
+	}
+	for i := range targets {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results, nil
+}
+
+// rollbackTarget retrieves the resource named by target and rolls it back.
+func rollbackTarget(c kubernetes.Interface, target RollbackTarget, opts BatchRollbackOptions) RollbackResult {
+	result := RollbackResult{Target: target}
+	rollbacker, err := RollbackerWithOptions(target.Kind, c, opts.RollbackerOptions)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	obj, err := getRollbackObject(c, target)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Result, result.Err = rollbackWithOptions(rollbacker, obj, RollbackOptions{ToRevision: target.ToRevision, DryRun: opts.DryRun})
+	return result
+}
+
+// rollbackWithOptions rolls back obj with r as described by opts, falling back to Rollback if r is not an
+// OptionsRollbacker.
+func rollbackWithOptions(r Rollbacker, obj runtime.Object, opts RollbackOptions) (string, error) {
+	if or, ok := r.(OptionsRollbacker); ok {
+		return or.RollbackWithOptions(obj, opts)
+	}
+	return r.Rollback(obj, opts.UpdatedAnnotations, opts.ToRevision, opts.DryRun)
+}
+
+// getRollbackObject returns the resource named by target in the form expected by its Rollbacker.
+func getRollbackObject(c kubernetes.Interface, target RollbackTarget) (runtime.Object, error) {
+	switch target.Kind {
+	case extensions.Kind("Deployment"), apps.Kind("Deployment"):
+		deployment, err := c.ExtensionsV1beta1().Deployments(target.Namespace).Get(target.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve deployment %s: %v", target.Name, err)
+		}
+		return deployment, nil
+	case extensions.Kind("DaemonSet"), apps.Kind("DaemonSet"):
+		ds, err := c.ExtensionsV1beta1().DaemonSets(target.Namespace).Get(target.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve DaemonSet %s: %v", target.Name, err)
+		}
+		return ds, nil
+	case apps.Kind("StatefulSet"):
+		sts, err := c.AppsV1beta1().StatefulSets(target.Namespace).Get(target.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve StatefulSet %s: %v", target.Name, err)
+		}
+		return sts, nil
+	case api.Kind("ReplicationController"):
+		rc, err := c.CoreV1().ReplicationControllers(target.Namespace).Get(target.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve ReplicationController %s: %v", target.Name, err)
+		}
+		return rc, nil
+	}
+	return nil, &UnsupportedKindError{Kind: target.Kind, Operation: "rollbacker"}
+}
+
+// ResolveRollbackTargets returns the objects of the given kind in namespace whose labels match selector,
+// in the form their Rollbacker expects. All matching objects are returned, it is up to the caller to
+// decide what to do when more than one object matches.
+func ResolveRollbackTargets(c kubernetes.Interface, kind schema.GroupKind, namespace string, selector labels.Selector) ([]runtime.Object, error) {
+	options := metav1.ListOptions{LabelSelector: selector.String()}
+	var objs []runtime.Object
+	switch kind {
+	case extensions.Kind("Deployment"), apps.Kind("Deployment"):
+		deployments, err := c.ExtensionsV1beta1().Deployments(namespace).List(options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deployments matching %q: %v", selector, err)
+		}
+		for i := range deployments.Items {
+			objs = append(objs, &deployments.Items[i])
+		}
+	case extensions.Kind("DaemonSet"), apps.Kind("DaemonSet"):
+		daemonSets, err := c.ExtensionsV1beta1().DaemonSets(namespace).List(options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list DaemonSets matching %q: %v", selector, err)
+		}
+		for i := range daemonSets.Items {
+			objs = append(objs, &daemonSets.Items[i])
+		}
+	case apps.Kind("StatefulSet"):
+		statefulSets, err := c.AppsV1beta1().StatefulSets(namespace).List(options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list StatefulSets matching %q: %v", selector, err)
+		}
+		for i := range statefulSets.Items {
+			objs = append(objs, &statefulSets.Items[i])
+		}
+	case api.Kind("ReplicationController"):
+		rcs, err := c.CoreV1().ReplicationControllers(namespace).List(options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list ReplicationControllers matching %q: %v", selector, err)
+		}
+		for i := range rcs.Items {
+			objs = append(objs, &rcs.Items[i])
+		}
+	default:
+		return nil, &UnsupportedKindError{Kind: kind, Operation: "rollbacker"}
+	}
+	return objs, nil
+}
@@ -0,0 +1,1907 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/ghodss/yaml"
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	"k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apimachinery/pkg/watch"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/legacyscheme"
+	"k8s.io/kubernetes/pkg/apis/apps"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	deploymentutil "k8s.io/kubernetes/pkg/controller/deployment/util"
+)
+
+// newPatchingClientset returns a fake clientset holding objects that, unlike the
+// default fake clientset, applies strategic merge patches to the objects it tracks.
+func newPatchingClientset(objects ...runtime.Object) *fake.Clientset {
+	tracker := clienttesting.NewObjectTracker(scheme.Scheme, scheme.Codecs.UniversalDecoder())
+	for _, obj := range objects {
+		if err := tracker.Add(obj); err != nil {
+			panic(err)
+		}
+	}
+	client := &fake.Clientset{}
+	client.AddReactor("patch", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(clienttesting.PatchAction)
+		obj, err := tracker.Get(action.GetResource(), action.GetNamespace(), patchAction.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		original, err := json.Marshal(obj)
+		if err != nil {
+			return true, nil, err
+		}
+		patched, err := strategicpatch.StrategicMergePatch(original, patchAction.GetPatch(), obj)
+		if err != nil {
+			return true, nil, err
+		}
+		newObj := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+		if err := json.Unmarshal(patched, newObj); err != nil {
+			return true, nil, err
+		}
+		if err := tracker.Update(action.GetResource(), newObj, action.GetNamespace()); err != nil {
+			return true, nil, err
+		}
+		return true, newObj, nil
+	})
+	client.AddReactor("*", "*", clienttesting.ObjectReaction(tracker))
+	return client
+}
+
+func rollbackTestTemplate(image string) v1.PodTemplateSpec {
+	return v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "foo"}},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "foo", Image: image}},
+		},
+	}
+}
+
+// rollbackTestHistory returns a controllerrevision of the given revision owned by owner, storing
+// template in the same form the DaemonSet and StatefulSet controllers do.
+func rollbackTestHistory(t *testing.T, owner metav1.Object, gvk schema.GroupVersionKind, revision int64, template v1.PodTemplateSpec) *appsv1beta1.ControllerRevision {
+	templateBytes, err := json.Marshal(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(templateBytes, &raw); err != nil {
+		t.Fatal(err)
+	}
+	raw["$patch"] = "replace"
+	patch, err := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"template": raw}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &appsv1beta1.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            fmt.Sprintf("%s-%d", owner.GetName(), revision),
+			Namespace:       owner.GetNamespace(),
+			Labels:          map[string]string{"app": "foo"},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(owner, gvk)},
+		},
+		Data:     runtime.RawExtension{Raw: patch},
+		Revision: revision,
+	}
+}
+
+func TestDaemonSetRollbackUpdatedAnnotations(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := newPatchingClientset(ds,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")))
+
+	rollbacker := &DaemonSetRollbacker{c: client}
+	annotations := map[string]string{ChangeCauseAnnotation: "rollback to revision 1"}
+	result, err := rollbacker.Rollback(ds, annotations, 1, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != rollbackSuccess {
+		t.Errorf("expected result %q, got %q", rollbackSuccess, result)
+	}
+
+	live, err := client.ExtensionsV1beta1().DaemonSets(ds.Namespace).Get(ds.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := live.Annotations[ChangeCauseAnnotation]; got != "rollback to revision 1" {
+		t.Errorf("expected change-cause %q, got %q", "rollback to revision 1", got)
+	}
+	if got := live.Spec.Template.Spec.Containers[0].Image; got != "foo:v1" {
+		t.Errorf("expected image %q, got %q", "foo:v1", got)
+	}
+}
+
+func TestStatefulSetRollbackUpdatedAnnotations(t *testing.T) {
+	sts := rollbackTestStatefulSet("foo:v2")
+	gvk := appsv1beta1.SchemeGroupVersion.WithKind("StatefulSet")
+	client := newPatchingClientset(sts,
+		rollbackTestHistory(t, sts, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, sts, gvk, 2, rollbackTestTemplate("foo:v2")))
+
+	rollbacker := &StatefulSetRollbacker{c: client}
+	annotations := map[string]string{ChangeCauseAnnotation: "rollback to revision 1"}
+	result, err := rollbacker.Rollback(sts, annotations, 1, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != rollbackSuccess {
+		t.Errorf("expected result %q, got %q", rollbackSuccess, result)
+	}
+
+	live, err := client.AppsV1beta1().StatefulSets(sts.Namespace).Get(sts.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := live.Annotations[ChangeCauseAnnotation]; got != "rollback to revision 1" {
+		t.Errorf("expected change-cause %q, got %q", "rollback to revision 1", got)
+	}
+	if got := live.Spec.Template.Spec.Containers[0].Image; got != "foo:v1" {
+		t.Errorf("expected image %q, got %q", "foo:v1", got)
+	}
+}
+
+func TestDeploymentRollbackerWaitForRollout(t *testing.T) {
+	replicas := int32(2)
+	tests := []struct {
+		name     string
+		status   extensionsv1beta1.DeploymentStatus
+		expected string
+	}{
+		{
+			name: "rollout complete",
+			status: extensionsv1beta1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           2,
+				UpdatedReplicas:    2,
+				AvailableReplicas:  2,
+			},
+		},
+		{
+			name: "generation not observed",
+			status: extensionsv1beta1.DeploymentStatus{
+				ObservedGeneration: 1,
+				Replicas:           2,
+				UpdatedReplicas:    2,
+				AvailableReplicas:  2,
+			},
+			expected: `timed out waiting for deployment "foo" rollback to complete: 0 of 2 replicas are updated, 2 of 2 are available`,
+		},
+		{
+			name: "replicas unavailable",
+			status: extensionsv1beta1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           2,
+				UpdatedReplicas:    2,
+				AvailableReplicas:  1,
+			},
+			expected: `timed out waiting for deployment "foo" rollback to complete: 2 of 2 replicas are updated, 1 of 2 are available`,
+		},
+		{
+			name: "old replicas available",
+			status: extensionsv1beta1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           3,
+				UpdatedReplicas:    1,
+				AvailableReplicas:  2,
+			},
+			expected: `timed out waiting for deployment "foo" rollback to complete: 1 of 2 replicas are updated, 2 of 2 are available`,
+		},
+		{
+			name: "progress deadline exceeded",
+			status: extensionsv1beta1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           2,
+				UpdatedReplicas:    1,
+				AvailableReplicas:  1,
+				Conditions: []extensionsv1beta1.DeploymentCondition{{
+					Type:   extensionsv1beta1.DeploymentProgressing,
+					Status: v1.ConditionFalse,
+					Reason: "ProgressDeadlineExceeded",
+				}},
+			},
+			expected: `deployment "foo" exceeded its progress deadline`,
+		},
+	}
+	for _, test := range tests {
+		d := &extensionsv1beta1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault, Generation: 2},
+			Spec:       extensionsv1beta1.DeploymentSpec{Replicas: &replicas},
+			Status:     test.status,
+		}
+		rollbacker := &DeploymentRollbacker{
+			c:                 fake.NewSimpleClientset(d),
+			RollbackerOptions: RollbackerOptions{WaitForRollout: true, Timeout: 10 * time.Millisecond},
+		}
+		err := rollbacker.waitForRollout(d.Namespace, d.Name)
+		if len(test.expected) == 0 && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if len(test.expected) > 0 && (err == nil || err.Error() != test.expected) {
+			t.Errorf("%s: expected error %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+// rollbackTestDeployment returns a deployment running image.
+func rollbackTestDeployment(image string) *extensionsv1beta1.Deployment {
+	replicas := int32(1)
+	return &extensionsv1beta1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault, UID: "foo-uid"},
+		Spec: extensionsv1beta1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo"}},
+			Template: rollbackTestTemplate(image),
+		},
+	}
+}
+
+// rollbackTestDaemonSet returns a daemon set running image.
+func rollbackTestDaemonSet(image string) *extensionsv1beta1.DaemonSet {
+	return &extensionsv1beta1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault, UID: "foo-uid"},
+		Spec: extensionsv1beta1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo"}},
+			Template: rollbackTestTemplate(image),
+		},
+	}
+}
+
+// rollbackTestStatefulSet returns a stateful set running image.
+func rollbackTestStatefulSet(image string) *appsv1beta1.StatefulSet {
+	return &appsv1beta1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault, UID: "foo-uid"},
+		Spec: appsv1beta1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo"}},
+			Template: rollbackTestTemplate(image),
+		},
+	}
+}
+
+// rollbackTestReplicaSet returns a replicaset of the given revision of deployment running image.
+func rollbackTestReplicaSet(deployment *extensionsv1beta1.Deployment, revision int64, image string) *extensionsv1beta1.ReplicaSet {
+	template := rollbackTestTemplate(image)
+	template.Labels["pod-template-hash"] = fmt.Sprintf("hash-%d", revision)
+	return &extensionsv1beta1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            fmt.Sprintf("%s-%d", deployment.Name, revision),
+			Namespace:       deployment.Namespace,
+			UID:             types.UID(fmt.Sprintf("%s-%d-uid", deployment.Name, revision)),
+			Labels:          template.Labels,
+			Annotations:     map[string]string{"deployment.kubernetes.io/revision": fmt.Sprintf("%d", revision)},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(deployment, extensionsv1beta1.SchemeGroupVersion.WithKind("Deployment"))},
+		},
+		Spec: extensionsv1beta1.ReplicaSetSpec{
+			Replicas: deployment.Spec.Replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: template.Labels},
+			Template: template,
+		},
+	}
+}
+
+func TestDeploymentRollbackSkipsMatchingRevision(t *testing.T) {
+	deployment := rollbackTestDeployment("foo:v2")
+	internalDeployment := &extensions.Deployment{}
+	if err := legacyscheme.Scheme.Convert(deployment, internalDeployment, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		toRevision int64
+		expectSkip bool
+	}{
+		{name: "current revision", toRevision: 2, expectSkip: true},
+		{name: "previous revision", toRevision: 1, expectSkip: false},
+		{name: "last revision", toRevision: 0, expectSkip: false},
+	}
+	for _, test := range tests {
+		client := fake.NewSimpleClientset(deployment, rollbackTestReplicaSet(deployment, 1, "foo:v1"), rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+		// Fail the rollback request itself, the pre-check must not reach it when the revision matches
+		client.PrependReactor("create", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("rollback issued")
+		})
+		rollbacker := &DeploymentRollbacker{c: client}
+		result, err := rollbacker.Rollback(internalDeployment, nil, test.toRevision, false)
+		if test.expectSkip {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			if !strings.HasPrefix(result, rollbackSkipped) {
+				t.Errorf("%s: expected rollback to be skipped, got %q", test.name, result)
+			}
+			continue
+		}
+		if err == nil || err.Error() != "rollback issued" {
+			t.Errorf("%s: expected rollback to be issued, got result %q and error %v", test.name, result, err)
+		}
+	}
+
+	// The last revision is reported by its number
+	rolledBack := rollbackTestDeployment("foo:v1")
+	client := fake.NewSimpleClientset(rolledBack, rollbackTestReplicaSet(rolledBack, 1, "foo:v1"), rollbackTestReplicaSet(rolledBack, 2, "foo:v2"))
+	rollbacker := &DeploymentRollbacker{c: client}
+	result, err := rollbacker.Rollback(internalDeployment, nil, 0, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "skipped rollback (current template already matches revision 1)"; result != expected {
+		t.Errorf("expected result %q, got %q", expected, result)
+	}
+}
+
+// recordingTemplatePrinter is a TemplatePrinter that records the templates it is asked to print.
+type recordingTemplatePrinter struct {
+	templates []*v1.PodTemplateSpec
+}
+
+func (p *recordingTemplatePrinter) PrintTemplate(template *v1.PodTemplateSpec) (string, error) {
+	p.templates = append(p.templates, template)
+	return "template", nil
+}
+
+func TestDaemonSetRollbackDryRunTemplatePrinter(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := fake.NewSimpleClientset(ds,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")))
+
+	printer := &recordingTemplatePrinter{}
+	rollbacker := &DaemonSetRollbacker{c: client, RollbackerOptions: RollbackerOptions{TemplatePrinter: printer}}
+	result, err := rollbacker.Rollback(ds, nil, 1, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "summary: revision 1 changes 1 container image\nwill roll back to template" {
+		t.Errorf("unexpected result %q", result)
+	}
+	if len(printer.templates) != 1 {
+		t.Fatalf("expected 1 template to be printed, got %d", len(printer.templates))
+	}
+	if image := printer.templates[0].Spec.Containers[0].Image; image != "foo:v1" {
+		t.Errorf("expected template of revision 1 with image %q, got %q", "foo:v1", image)
+	}
+}
+
+func TestBatchRollback(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	targets := []RollbackTarget{
+		{Kind: extensions.Kind("DaemonSet"), Namespace: ds.Namespace, Name: ds.Name, ToRevision: 1},
+		{Kind: extensions.Kind("DaemonSet"), Namespace: ds.Namespace, Name: "missing"},
+		{Kind: extensions.Kind("ReplicaSet"), Namespace: ds.Namespace, Name: "foo"},
+		{Kind: extensions.Kind("DaemonSet"), Namespace: ds.Namespace, Name: ds.Name, ToRevision: 3},
+	}
+	for _, workers := range []int{0, 2, 10} {
+		client := newPatchingClientset(ds,
+			rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+			rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")))
+
+		results, err := BatchRollbackWithOptions(client, targets, BatchRollbackOptions{Workers: workers})
+		if err != nil {
+			t.Fatalf("workers=%d: unexpected error: %v", workers, err)
+		}
+		if len(results) != len(targets) {
+			t.Fatalf("workers=%d: expected %d results, got %d", workers, len(targets), len(results))
+		}
+		for i, result := range results {
+			if !reflect.DeepEqual(result.Target, targets[i]) {
+				t.Errorf("workers=%d: expected result %d for target %v, got %v", workers, i, targets[i], result.Target)
+			}
+		}
+		if results[0].Err != nil || results[0].Result != rollbackSuccess {
+			t.Errorf("workers=%d: expected %s to be rolled back, got %q, %v", workers, ds.Name, results[0].Result, results[0].Err)
+		}
+		for _, result := range results[1:] {
+			if result.Err == nil {
+				t.Errorf("workers=%d: expected an error for target %v, got result %q", workers, result.Target, result.Result)
+			}
+		}
+	}
+}
+
+func TestBatchRollbackDeploymentDryRun(t *testing.T) {
+	deployment := rollbackTestDeployment("foo:v2")
+	client := fake.NewSimpleClientset(deployment, rollbackTestReplicaSet(deployment, 1, "foo:v1"), rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+	targets := []RollbackTarget{{Kind: extensions.Kind("Deployment"), Namespace: deployment.Namespace, Name: deployment.Name, ToRevision: 1}}
+
+	// The versioned deployment is handed to the rollbacker as retrieved
+	results, err := BatchRollbackWithOptions(client, targets, BatchRollbackOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[0].Err != nil {
+		t.Fatalf("unexpected error: %v", results[0].Err)
+	}
+	if !strings.Contains(results[0].Result, "foo:v1") {
+		t.Errorf("expected the dry-run to render revision 1, got %q", results[0].Result)
+	}
+}
+
+func TestStatefulSetRollbackChangeCauseSource(t *testing.T) {
+	tests := []struct {
+		name              string
+		toRevision        int64
+		annotations       map[string]string
+		expectChangeCause string
+	}{
+		{
+			name:              "synthesized",
+			toRevision:        1,
+			expectChangeCause: "rollback to revision 1 via release-bot",
+		},
+		{
+			name:              "synthesized for previous revision",
+			toRevision:        0,
+			annotations:       map[string]string{"foo": "bar"},
+			expectChangeCause: "rollback to revision 1 via release-bot",
+		},
+		{
+			name:              "explicit change-cause wins",
+			toRevision:        1,
+			annotations:       map[string]string{ChangeCauseAnnotation: "revert bad release"},
+			expectChangeCause: "revert bad release",
+		},
+	}
+	for _, test := range tests {
+		sts := rollbackTestStatefulSet("foo:v2")
+		gvk := appsv1beta1.SchemeGroupVersion.WithKind("StatefulSet")
+		client := newPatchingClientset(sts,
+			rollbackTestHistory(t, sts, gvk, 1, rollbackTestTemplate("foo:v1")),
+			rollbackTestHistory(t, sts, gvk, 2, rollbackTestTemplate("foo:v2")))
+
+		rollbacker := &StatefulSetRollbacker{c: client, RollbackerOptions: RollbackerOptions{ChangeCauseSource: "release-bot"}}
+		original := fmt.Sprint(test.annotations)
+		if _, err := rollbacker.Rollback(sts, test.annotations, test.toRevision, false); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if fmt.Sprint(test.annotations) != original {
+			t.Errorf("%s: expected the updated annotations not to be modified, got %v", test.name, test.annotations)
+		}
+		live, err := client.AppsV1beta1().StatefulSets(sts.Namespace).Get(sts.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if got := live.Annotations[ChangeCauseAnnotation]; got != test.expectChangeCause {
+			t.Errorf("%s: expected change-cause %q, got %q", test.name, test.expectChangeCause, got)
+		}
+	}
+}
+
+func TestDeploymentRollbackServerDryRunPaused(t *testing.T) {
+	deployment := rollbackTestDeployment("foo:v2")
+	deployment.Spec.Paused = true
+	client := fake.NewSimpleClientset(deployment, rollbackTestReplicaSet(deployment, 1, "foo:v1"), rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+	client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.13.0"}
+	obj := &extensions.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault}}
+	rollbacker := &DeploymentRollbacker{c: client, RollbackerOptions: RollbackerOptions{ServerDryRun: true}}
+	_, err := rollbacker.Rollback(obj, nil, 1, true)
+	if _, ok := err.(*PausedError); !ok {
+		t.Errorf("expected *PausedError, got %#v", err)
+	}
+}
+
+func TestServerSupportsDryRun(t *testing.T) {
+	tests := []struct {
+		gitVersion string
+		expected   bool
+	}{
+		{gitVersion: "v1.8.4", expected: false},
+		{gitVersion: "v1.13.0", expected: true},
+		{gitVersion: "v1.14.1-gke.2", expected: true},
+		{gitVersion: "not a version", expected: false},
+	}
+	for _, test := range tests {
+		client := fake.NewSimpleClientset()
+		client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: test.gitVersion}
+		if got := serverSupportsDryRun(client); got != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.gitVersion, test.expected, got)
+		}
+	}
+}
+
+func TestDaemonSetServerDryRunFallback(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := fake.NewSimpleClientset(ds,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")))
+	client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.8.4"}
+
+	printer := &recordingTemplatePrinter{}
+	rollbacker := &DaemonSetRollbacker{c: client, RollbackerOptions: RollbackerOptions{ServerDryRun: true, TemplatePrinter: printer}}
+	if _, err := rollbacker.Rollback(ds, nil, 1, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(printer.templates) != 1 || printer.templates[0].Spec.Containers[0].Image != "foo:v1" {
+		t.Errorf("expected the locally reconstructed template of revision 1 to be printed, got %v", printer.templates)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("expected no patch to be sent to a server without dry-run support, got %v", action)
+		}
+	}
+}
+
+func TestDeploymentRollbackPollsWithoutEvents(t *testing.T) {
+	deployment := rollbackTestDeployment("foo:v2")
+	internalDeployment := &extensions.Deployment{}
+	if err := legacyscheme.Scheme.Convert(deployment, internalDeployment, nil); err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewSimpleClientset(deployment, rollbackTestReplicaSet(deployment, 1, "foo:v1"), rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+	client.PrependReactor("list", "events", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(api.Resource("events"), "", fmt.Errorf("no access"))
+	})
+	// The rollback is accepted, but never applied
+	client.PrependReactor("create", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+
+	rollbacker := &DeploymentRollbacker{c: client, RollbackerOptions: RollbackerOptions{Timeout: 10 * time.Millisecond}}
+	result, err := rollbacker.Rollback(internalDeployment, nil, 1, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(result, rollbackSkipped) {
+		t.Errorf("expected the rollback to be reported as skipped, got %q", result)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "watch" {
+			t.Errorf("expected events not to be watched, got %v", action)
+		}
+	}
+}
+
+func TestDeploymentRollbackerPollRollback(t *testing.T) {
+	tests := []struct {
+		name         string
+		image        string
+		rollbackTo   *extensionsv1beta1.RollbackConfig
+		observed     int64
+		expectResult string
+		expectErr    bool
+	}{
+		{
+			name:         "rolled back",
+			image:        "foo:v1",
+			observed:     2,
+			expectResult: rollbackSuccess,
+		},
+		{
+			name:       "rollback pending",
+			image:      "foo:v2",
+			rollbackTo: &extensionsv1beta1.RollbackConfig{Revision: 1},
+			observed:   2,
+			expectErr:  true,
+		},
+		{
+			name:      "generation not observed",
+			image:     "foo:v1",
+			observed:  1,
+			expectErr: true,
+		},
+		{
+			name:         "rollback not applied",
+			image:        "foo:v2",
+			observed:     2,
+			expectResult: rollbackSkipped,
+		},
+	}
+	for _, test := range tests {
+		deployment := rollbackTestDeployment(test.image)
+		deployment.Generation = 2
+		deployment.Spec.RollbackTo = test.rollbackTo
+		deployment.Status.ObservedGeneration = test.observed
+		rollbacker := &DeploymentRollbacker{
+			c:                 fake.NewSimpleClientset(deployment),
+			RollbackerOptions: RollbackerOptions{Timeout: 10 * time.Millisecond},
+		}
+		template := rollbackTestTemplate("foo:v1")
+		result, err := rollbacker.pollRollback(deployment.Namespace, deployment.Name, &template, time.Now().Add(rollbacker.timeout()))
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got result %q", test.name, result)
+			} else if !strings.HasPrefix(err.Error(), "rollback status unknown after 10ms") {
+				t.Errorf("%s: expected the timeout to be reported, got %v", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !strings.HasPrefix(result, test.expectResult) {
+			t.Errorf("%s: expected result %q, got %q", test.name, test.expectResult, result)
+		}
+	}
+}
+
+func TestDeploymentRollbackerPollRollbackPastDeadline(t *testing.T) {
+	deployment := rollbackTestDeployment("foo:v1")
+	deployment.Generation = 2
+	deployment.Status.ObservedGeneration = 2
+	rollbacker := &DeploymentRollbacker{c: fake.NewSimpleClientset(deployment)}
+	template := rollbackTestTemplate("foo:v1")
+	// The deadline was used up by the event watch, the deployment is still checked once
+	result, err := rollbacker.pollRollback(deployment.Namespace, deployment.Name, &template, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != rollbackSuccess {
+		t.Errorf("expected result %q, got %q", rollbackSuccess, result)
+	}
+}
+
+func TestFindHistory(t *testing.T) {
+	newHistories := func(revisions ...int64) []*appsv1beta1.ControllerRevision {
+		var histories []*appsv1beta1.ControllerRevision
+		for _, r := range revisions {
+			histories = append(histories, &appsv1beta1.ControllerRevision{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("foo-%d", r)},
+				Revision:   r,
+			})
+		}
+		return histories
+	}
+	// colliding returns histories where revision 2 collided, foo-2-b being the most recent one
+	colliding := func() []*appsv1beta1.ControllerRevision {
+		older := metav1.NewTime(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+		newer := metav1.NewTime(older.Add(time.Hour))
+		return []*appsv1beta1.ControllerRevision{
+			{ObjectMeta: metav1.ObjectMeta{Name: "foo-1", CreationTimestamp: older}, Revision: 1},
+			{ObjectMeta: metav1.ObjectMeta{Name: "foo-2-b", CreationTimestamp: newer}, Revision: 2},
+			{ObjectMeta: metav1.ObjectMeta{Name: "foo-2-a", CreationTimestamp: older}, Revision: 2},
+		}
+	}
+	tests := []struct {
+		name       string
+		toRevision int64
+		history    []*appsv1beta1.ControllerRevision
+		expected   string
+	}{
+		{name: "specific revision", toRevision: 2, history: newHistories(3, 1, 2), expected: "foo-2"},
+		{name: "missing revision", toRevision: 4, history: newHistories(3, 1, 2)},
+		{name: "previous revision", toRevision: 0, history: newHistories(3, 1, 2), expected: "foo-2"},
+		{name: "previous revision of a single revision", toRevision: 0, history: newHistories(1)},
+		{name: "no history", toRevision: 1},
+		{name: "colliding revision", toRevision: 2, history: colliding(), expected: "foo-2-b"},
+		{name: "previous revision of a colliding current revision", toRevision: 0, history: colliding(), expected: "foo-1"},
+		{name: "colliding previous revision", toRevision: 0, history: append(colliding(), newHistories(3)...), expected: "foo-2-b"},
+		{name: "previous revision of a single colliding revision", toRevision: 0, history: colliding()[1:]},
+	}
+	for _, test := range tests {
+		history := FindHistory(test.toRevision, test.history)
+		switch {
+		case len(test.expected) == 0 && history != nil:
+			t.Errorf("%s: expected no history, got %s", test.name, history.Name)
+		case len(test.expected) > 0 && history == nil:
+			t.Errorf("%s: expected %s, got none", test.name, test.expected)
+		case len(test.expected) > 0 && history.Name != test.expected:
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, history.Name)
+		}
+	}
+}
+
+func rollbackTestReplicationController(name string, revision int64, image string) *v1.ReplicationController {
+	// Like the replication controllers of rolling updates, each one selects its own pods
+	template := rollbackTestTemplate(image)
+	template.Labels["deployment"] = name
+	return &v1.ReplicationController{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   metav1.NamespaceDefault,
+			Labels:      map[string]string{"app": "foo"},
+			Annotations: map[string]string{"deployment.kubernetes.io/revision": fmt.Sprintf("%d", revision)},
+		},
+		Spec: v1.ReplicationControllerSpec{
+			Selector: map[string]string{"app": "foo", "deployment": name},
+			Template: &template,
+		},
+	}
+}
+
+func TestReplicationControllerRollback(t *testing.T) {
+	tests := []struct {
+		name          string
+		toRevision    int64
+		expectedImage string
+		expectSkip    bool
+	}{
+		{name: "current revision", toRevision: 3, expectedImage: "foo:v3", expectSkip: true},
+		{name: "explicit revision", toRevision: 1, expectedImage: "foo:v1"},
+		{name: "last revision", toRevision: 0, expectedImage: "foo:v2"},
+	}
+	for _, test := range tests {
+		current := rollbackTestReplicationController("foo-3", 3, "foo:v3")
+		client := newPatchingClientset(
+			rollbackTestReplicationController("foo-1", 1, "foo:v1"),
+			rollbackTestReplicationController("foo-2", 2, "foo:v2"),
+			current,
+		)
+		rollbacker := &ReplicationControllerRollbacker{c: client}
+		result, err := rollbacker.Rollback(current, map[string]string{"key": "value"}, test.toRevision, false)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if test.expectSkip != strings.HasPrefix(result, rollbackSkipped) {
+			t.Errorf("%s: unexpected result %q", test.name, result)
+		}
+		rc, err := client.CoreV1().ReplicationControllers(metav1.NamespaceDefault).Get("foo-3", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if image := rc.Spec.Template.Spec.Containers[0].Image; image != test.expectedImage {
+			t.Errorf("%s: expected image %q, got %q", test.name, test.expectedImage, image)
+		}
+		if !labels.SelectorFromSet(rc.Spec.Selector).Matches(labels.Set(rc.Spec.Template.Labels)) {
+			t.Errorf("%s: expected the pod template labels %v to match the selector %v", test.name, rc.Spec.Template.Labels, rc.Spec.Selector)
+		}
+		if !test.expectSkip && rc.Annotations["key"] != "value" {
+			t.Errorf("%s: expected updated annotations to be recorded, got %v", test.name, rc.Annotations)
+		}
+	}
+
+	current := rollbackTestReplicationController("foo-2", 2, "foo:v2")
+	client := newPatchingClientset(rollbackTestReplicationController("foo-1", 1, "foo:v1"), current)
+	unsupported := []RollbackerOptions{
+		{ServerDryRun: true},
+		{PatchType: types.MergePatchType},
+	}
+	for _, opts := range unsupported {
+		rollbacker := &ReplicationControllerRollbacker{c: client, RollbackerOptions: opts}
+		if _, err := rollbacker.Rollback(current, nil, 1, true); err == nil {
+			t.Errorf("%+v: expected an error for an unsupported option", opts)
+		}
+	}
+
+	client = fake.NewSimpleClientset(rollbackTestReplicationController("foo-1", 1, "foo:v1"))
+	rollbacker := &ReplicationControllerRollbacker{c: client}
+	if _, err := rollbacker.Rollback(rollbackTestReplicationController("foo-1", 1, "foo:v1"), nil, 0, false); err == nil {
+		t.Errorf("expected an error rolling back without a previous revision")
+	}
+}
+
+func TestBatchRollbackReplicationController(t *testing.T) {
+	client := newPatchingClientset(
+		rollbackTestReplicationController("foo-1", 1, "foo:v1"),
+		rollbackTestReplicationController("foo-2", 2, "foo:v2"),
+	)
+	targets := []RollbackTarget{
+		{Kind: api.Kind("ReplicationController"), Namespace: metav1.NamespaceDefault, Name: "foo-2", ToRevision: 1},
+		{Kind: api.Kind("ReplicationController"), Namespace: metav1.NamespaceDefault, Name: "missing"},
+	}
+	results, err := BatchRollback(client, targets)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != len(targets) {
+		t.Fatalf("expected %d results, got %d", len(targets), len(results))
+	}
+	if results[0].Err != nil || results[0].Result != rollbackSuccess {
+		t.Errorf("expected foo-2 to be rolled back, got %q, %v", results[0].Result, results[0].Err)
+	}
+	if results[1].Err == nil {
+		t.Errorf("expected an error for a missing ReplicationController, got result %q", results[1].Result)
+	}
+	rc, err := client.CoreV1().ReplicationControllers(metav1.NamespaceDefault).Get("foo-2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image := rc.Spec.Template.Spec.Containers[0].Image; image != "foo:v1" {
+		t.Errorf("expected image foo:v1, got %q", image)
+	}
+}
+
+func TestStatefulSetRollbackPartition(t *testing.T) {
+	tests := []struct {
+		name              string
+		clearPartition    bool
+		expectedResult    string
+		expectedPartition int32
+	}{
+		{
+			name:              "warn",
+			expectedResult:    "rolled back (partition is 2: only pods with ordinal 2 or higher will be reverted, pods with a lower ordinal keep their current revision)",
+			expectedPartition: 2,
+		},
+		{
+			name:              "clear",
+			clearPartition:    true,
+			expectedResult:    rollbackSuccess,
+			expectedPartition: 0,
+		},
+	}
+	for _, test := range tests {
+		replicas, partition := int32(3), int32(2)
+		sts := rollbackTestStatefulSet("foo:v2")
+		sts.Spec.Replicas = &replicas
+		sts.Spec.UpdateStrategy = appsv1beta1.StatefulSetUpdateStrategy{
+			Type:          appsv1beta1.RollingUpdateStatefulSetStrategyType,
+			RollingUpdate: &appsv1beta1.RollingUpdateStatefulSetStrategy{Partition: &partition},
+		}
+		gvk := appsv1beta1.SchemeGroupVersion.WithKind("StatefulSet")
+		client := newPatchingClientset(sts,
+			rollbackTestHistory(t, sts, gvk, 1, rollbackTestTemplate("foo:v1")),
+			rollbackTestHistory(t, sts, gvk, 2, rollbackTestTemplate("foo:v2")))
+
+		rollbacker := &StatefulSetRollbacker{c: client, RollbackerOptions: RollbackerOptions{ClearPartition: test.clearPartition}}
+		result, err := rollbacker.Rollback(sts, nil, 1, false)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if result != test.expectedResult {
+			t.Errorf("%s: expected result %q, got %q", test.name, test.expectedResult, result)
+		}
+
+		live, err := client.AppsV1beta1().StatefulSets(sts.Namespace).Get(sts.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if got := *live.Spec.UpdateStrategy.RollingUpdate.Partition; got != test.expectedPartition {
+			t.Errorf("%s: expected partition %d, got %d", test.name, test.expectedPartition, got)
+		}
+		if got := live.Spec.Template.Spec.Containers[0].Image; got != "foo:v1" {
+			t.Errorf("%s: expected image %q, got %q", test.name, "foo:v1", got)
+		}
+	}
+}
+
+func TestRollbackDryRunDiff(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	dsGVK := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	v1Template := rollbackTestTemplate("foo:v1")
+	v1Template.Labels["tier"] = "web"
+	deployment := rollbackTestDeployment("foo:v2")
+	internalDeployment := &extensions.Deployment{}
+	if err := legacyscheme.Scheme.Convert(deployment, internalDeployment, nil); err != nil {
+		t.Fatal(err)
+	}
+	v1RS := rollbackTestReplicaSet(deployment, 1, "foo:v1")
+	v1RS.Spec.Template.Labels["tier"] = "web"
+	client := fake.NewSimpleClientset(ds,
+		rollbackTestHistory(t, ds, dsGVK, 1, v1Template),
+		rollbackTestHistory(t, ds, dsGVK, 2, rollbackTestTemplate("foo:v2")),
+		deployment,
+		v1RS,
+		rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+
+	expected := "summary: revision 1 changes 1 container image\n" +
+		"will change the pod template:\n" +
+		"  metadata.labels.tier:      <none>    ->  \"web\"\n" +
+		"  spec.containers[0].image:  \"foo:v2\"  ->  \"foo:v1\"\n"
+	opts := RollbackerOptions{DryRunDiff: true}
+	tests := []struct {
+		name       string
+		rollbacker Rollbacker
+		obj        runtime.Object
+	}{
+		{name: "daemonset", rollbacker: &DaemonSetRollbacker{c: client, RollbackerOptions: opts}, obj: ds},
+		{name: "deployment", rollbacker: &DeploymentRollbacker{c: client, RollbackerOptions: opts}, obj: internalDeployment},
+	}
+	for _, test := range tests {
+		result, err := test.rollbacker.Rollback(test.obj, nil, 1, true)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if result != expected {
+			t.Errorf("%s: expected diff:\n%s\ngot:\n%s", test.name, expected, result)
+		}
+	}
+
+	rollbacker := &DaemonSetRollbacker{c: client, RollbackerOptions: opts}
+	result, err := rollbacker.Rollback(ds, nil, 2, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "summary: revision 2 changes no container images, env vars or resources\nwill not change the pod template\n" {
+		t.Errorf("unexpected result %q", result)
+	}
+}
+
+func TestDryRunSummary(t *testing.T) {
+	live := rollbackTestTemplate("foo:v2")
+	live.Spec.Containers[0].Env = []v1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "2"}}
+	live.Spec.Containers[0].Resources.Limits = v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")}
+	live.Spec.Containers = append(live.Spec.Containers, v1.Container{Name: "sidecar", Image: "sidecar:v2"})
+
+	unchanged := live.DeepCopy()
+	image := live.DeepCopy()
+	image.Spec.Containers[0].Image = "foo:v1"
+	images := image.DeepCopy()
+	images.Spec.Containers[1].Image = "sidecar:v1"
+	env := live.DeepCopy()
+	env.Spec.Containers[0].Env = []v1.EnvVar{{Name: "A", Value: "0"}, {Name: "C", Value: "3"}}
+	all := images.DeepCopy()
+	all.Spec.Containers[0].Env = env.Spec.Containers[0].Env
+	all.Spec.Containers[0].Resources.Limits = v1.ResourceList{v1.ResourceCPU: resource.MustParse("200m")}
+
+	tests := []struct {
+		name     string
+		target   *v1.PodTemplateSpec
+		expected string
+	}{
+		{name: "unchanged", target: unchanged, expected: "summary: revision 3 changes no container images, env vars or resources\n"},
+		{name: "image", target: image, expected: "summary: revision 3 changes 1 container image\n"},
+		{name: "env", target: env, expected: "summary: revision 3 changes 3 env vars\n"},
+		{name: "all", target: all, expected: "summary: revision 3 changes 2 container images, 3 env vars and resources\n"},
+	}
+	for _, test := range tests {
+		if summary := dryRunSummary(3, &live, test.target); summary != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, summary)
+		}
+	}
+}
+
+func TestRollbackOnDeleteUpdateStrategy(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	ds.Spec.UpdateStrategy = extensionsv1beta1.DaemonSetUpdateStrategy{Type: extensionsv1beta1.OnDeleteDaemonSetStrategyType}
+	sts := rollbackTestStatefulSet("foo:v2")
+	sts.Name, sts.UID = "bar", "bar-uid"
+	sts.Spec.UpdateStrategy = appsv1beta1.StatefulSetUpdateStrategy{Type: appsv1beta1.OnDeleteStatefulSetStrategyType}
+	dsGVK := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	stsGVK := appsv1beta1.SchemeGroupVersion.WithKind("StatefulSet")
+	client := newPatchingClientset(ds, sts,
+		rollbackTestHistory(t, ds, dsGVK, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, dsGVK, 2, rollbackTestTemplate("foo:v2")),
+		rollbackTestHistory(t, sts, stsGVK, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, sts, stsGVK, 2, rollbackTestTemplate("foo:v2")))
+
+	tests := []struct {
+		name       string
+		rollbacker Rollbacker
+		obj        runtime.Object
+	}{
+		{name: "daemonset", rollbacker: &DaemonSetRollbacker{c: client}, obj: ds},
+		{name: "statefulset", rollbacker: &StatefulSetRollbacker{c: client}, obj: sts},
+	}
+	for _, test := range tests {
+		result, err := test.rollbacker.Rollback(test.obj, nil, 1, false)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if result != rollbackOnDelete {
+			t.Errorf("%s: expected result %q, got %q", test.name, rollbackOnDelete, result)
+		}
+	}
+}
+
+func TestWatchRollbackEvent(t *testing.T) {
+	tests := []struct {
+		name      string
+		unknown   runtime.Object
+		event     runtime.Object
+		signal    os.Signal
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "rollback done",
+			event:    &v1.Event{Reason: deploymentutil.RollbackDone},
+			expected: rollbackSuccess,
+		},
+		{
+			name:     "unrecognised object skipped",
+			unknown:  &api.Event{Reason: deploymentutil.RollbackDone},
+			event:    &v1.Event{Reason: deploymentutil.RollbackDone},
+			expected: rollbackSuccess,
+		},
+		{
+			// The empty result makes the caller poll the deployment for the rollback status
+			name:  "no rollback event",
+			event: &v1.Event{Reason: "ScalingReplicaSet"},
+		},
+		{
+			name:      "interrupted",
+			event:     &v1.Event{Reason: "ScalingReplicaSet"},
+			signal:    os.Interrupt,
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		w := watch.NewFakeWithChanSize(2, false)
+		if test.unknown != nil {
+			w.Add(test.unknown)
+		}
+		w.Add(test.event)
+		signals := make(chan os.Signal, 1)
+		if test.signal != nil {
+			signals <- test.signal
+		}
+		result, err := waitRollbackEvent(w, 10*time.Millisecond, signals, nil)
+		if (err != nil) != test.expectErr {
+			t.Errorf("%s: expected error %t, got %v", test.name, test.expectErr, err)
+		}
+		if result != test.expected {
+			t.Errorf("%s: expected result %q, got %q", test.name, test.expected, result)
+		}
+		if !w.IsStopped() {
+			t.Errorf("%s: expected the watch to be stopped", test.name)
+		}
+	}
+}
+
+func TestResolveRollbackTargets(t *testing.T) {
+	stable := rollbackTestDeployment("foo:v1")
+	stable.Labels = map[string]string{"app": "api", "track": "stable"}
+	canary := rollbackTestDeployment("foo:v1")
+	canary.Name = "foo-canary"
+	canary.Labels = map[string]string{"app": "api", "track": "canary"}
+	client := fake.NewSimpleClientset(stable, canary)
+
+	tests := []struct {
+		selector string
+		expected []string
+	}{
+		{selector: "app=api,track=stable", expected: []string{"foo"}},
+		{selector: "app=api", expected: []string{"foo", "foo-canary"}},
+		{selector: "app=web", expected: nil},
+	}
+	for _, test := range tests {
+		selector, err := labels.Parse(test.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objs, err := ResolveRollbackTargets(client, extensions.Kind("Deployment"), metav1.NamespaceDefault, selector)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.selector, err)
+			continue
+		}
+		var names []string
+		for _, obj := range objs {
+			deployment, ok := obj.(*extensionsv1beta1.Deployment)
+			if !ok {
+				t.Fatalf("%s: expected an extensions/v1beta1 Deployment, got %T", test.selector, obj)
+			}
+			names = append(names, deployment.Name)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.selector, test.expected, names)
+		}
+	}
+}
+
+func TestRollbackOnEvent(t *testing.T) {
+	deployment := rollbackTestDeployment("foo:v2")
+	internalDeployment := &extensions.Deployment{}
+	if err := legacyscheme.Scheme.Convert(deployment, internalDeployment, nil); err != nil {
+		t.Fatal(err)
+	}
+	ds := rollbackTestDaemonSet("foo:v2")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := newPatchingClientset(ds, deployment,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")),
+		rollbackTestReplicaSet(deployment, 1, "foo:v1"),
+		rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+	client.PrependReactor("create", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	client.PrependWatchReactor("events", func(action clienttesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewFakeWithChanSize(1, false)
+		w.Add(&v1.Event{Reason: deploymentutil.RollbackDone, Message: "Rolled back deployment \"foo\" to revision 1"})
+		return true, w, nil
+	})
+
+	tests := []struct {
+		name       string
+		obj        runtime.Object
+		kind       schema.GroupKind
+		toRevision int64
+		rollbacker func(RollbackerOptions) Rollbacker
+		expected   []RollbackProgress
+	}{
+		{
+			name:       "deployment",
+			obj:        internalDeployment,
+			kind:       extensions.Kind("Deployment"),
+			toRevision: 1,
+			rollbacker: func(opts RollbackerOptions) Rollbacker {
+				return &DeploymentRollbacker{c: client, RollbackerOptions: opts}
+			},
+			expected: []RollbackProgress{
+				{Stage: RollbackStageSubmitted},
+				{Stage: RollbackStageEvent, Message: "DeploymentRollback: Rolled back deployment \"foo\" to revision 1"},
+				{Stage: RollbackStageCompleted, Message: rollbackSuccess},
+			},
+		},
+		{
+			name:       "daemonset skipped",
+			obj:        ds,
+			kind:       extensions.Kind("DaemonSet"),
+			toRevision: 2,
+			rollbacker: func(opts RollbackerOptions) Rollbacker {
+				return &DaemonSetRollbacker{c: client, RollbackerOptions: opts}
+			},
+			expected: []RollbackProgress{
+				{Stage: RollbackStageSkipped, Message: "skipped rollback (current template already matches revision 2)"},
+			},
+		},
+		{
+			name:       "daemonset",
+			obj:        ds,
+			kind:       extensions.Kind("DaemonSet"),
+			toRevision: 1,
+			rollbacker: func(opts RollbackerOptions) Rollbacker {
+				return &DaemonSetRollbacker{c: client, RollbackerOptions: opts}
+			},
+			expected: []RollbackProgress{
+				{Stage: RollbackStageSubmitted},
+				{Stage: RollbackStageCompleted, Message: rollbackSuccess},
+			},
+		},
+	}
+	for _, test := range tests {
+		var progress []RollbackProgress
+		rollbacker := test.rollbacker(RollbackerOptions{OnEvent: func(p RollbackProgress) { progress = append(progress, p) }})
+		if _, err := rollbacker.Rollback(test.obj, nil, test.toRevision, false); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		// Every milestone names the object being rolled back
+		for i := range test.expected {
+			test.expected[i].Kind = test.kind
+			test.expected[i].Namespace = metav1.NamespaceDefault
+			test.expected[i].Name = "foo"
+		}
+		if !reflect.DeepEqual(progress, test.expected) {
+			t.Errorf("%s: expected progress %+v, got %+v", test.name, test.expected, progress)
+		}
+	}
+}
+
+func TestDeploymentRollbackPrunedRevision(t *testing.T) {
+	deployment := rollbackTestDeployment("foo:v3")
+	internalDeployment := &extensions.Deployment{}
+	if err := legacyscheme.Scheme.Convert(deployment, internalDeployment, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Revision 1 was pruned by the revision history limit
+	client := fake.NewSimpleClientset(deployment, rollbackTestReplicaSet(deployment, 2, "foo:v2"), rollbackTestReplicaSet(deployment, 3, "foo:v3"))
+
+	rollbacker := &DeploymentRollbacker{c: client}
+	_, err := rollbacker.Rollback(internalDeployment, nil, 1, false)
+	expected := "unable to find specified revision 1 in history (available revisions: 2, 3)"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "create" {
+			t.Errorf("expected the rollback not to be submitted, got %v", action)
+		}
+	}
+}
+
+func TestDeploymentRollbackAsync(t *testing.T) {
+	deployment := rollbackTestDeployment("foo:v2")
+	internalDeployment := &extensions.Deployment{}
+	if err := legacyscheme.Scheme.Convert(deployment, internalDeployment, nil); err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewSimpleClientset(deployment, rollbackTestReplicaSet(deployment, 1, "foo:v1"), rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+	client.PrependReactor("create", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	client.PrependReactor("*", "events", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(api.Resource("events"), "", fmt.Errorf("no access"))
+	})
+
+	rollbacker := &DeploymentRollbacker{c: client, RollbackerOptions: RollbackerOptions{Async: true}}
+	result, err := rollbacker.Rollback(internalDeployment, nil, 1, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != rollbackSubmitted {
+		t.Errorf("expected result %q, got %q", rollbackSubmitted, result)
+	}
+	submitted := false
+	for _, action := range client.Actions() {
+		if action.GetResource().Resource == "events" {
+			t.Errorf("expected events not to be accessed, got %v", action)
+		}
+		if action.GetVerb() == "create" && action.GetSubresource() == "rollback" {
+			submitted = true
+		}
+	}
+	if !submitted {
+		t.Errorf("expected the rollback to be submitted")
+	}
+}
+
+func TestRollbackerForObject(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	tests := []struct {
+		obj      runtime.Object
+		expected Rollbacker
+	}{
+		{obj: &extensions.Deployment{}, expected: &DeploymentRollbacker{c: client}},
+		{obj: &extensionsv1beta1.Deployment{}, expected: &DeploymentRollbacker{c: client}},
+		{obj: &appsv1beta1.Deployment{}, expected: &DeploymentRollbacker{c: client}},
+		{obj: &extensionsv1beta1.DaemonSet{}, expected: &DaemonSetRollbacker{c: client}},
+		{obj: &appsv1beta1.StatefulSet{}, expected: &StatefulSetRollbacker{c: client}},
+		{obj: &v1.ReplicationController{}, expected: &ReplicationControllerRollbacker{c: client}},
+	}
+	for _, test := range tests {
+		rollbacker, err := RollbackerForObject(test.obj, client)
+		if err != nil {
+			t.Errorf("%T: unexpected error: %v", test.obj, err)
+			continue
+		}
+		if !reflect.DeepEqual(rollbacker, test.expected) {
+			t.Errorf("%T: expected %T, got %T", test.obj, test.expected, rollbacker)
+		}
+	}
+
+	if _, err := RollbackerForObject(&extensionsv1beta1.ReplicaSet{}, client); err == nil {
+		t.Errorf("expected an error for an unsupported type")
+	}
+}
+
+func TestRollbackerForObjectExternalDeployment(t *testing.T) {
+	deployment := rollbackTestDeployment("foo:v2")
+	appsDeployment := &appsv1beta1.Deployment{}
+	if err := legacyscheme.Scheme.Convert(deployment, appsDeployment, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range []runtime.Object{deployment, appsDeployment} {
+		client := fake.NewSimpleClientset(deployment, rollbackTestReplicaSet(deployment, 1, "foo:v1"), rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+		client.PrependReactor("create", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			return true, nil, nil
+		})
+		rollbacker, err := RollbackerForObject(obj, client)
+		if err != nil {
+			t.Fatalf("%T: unexpected error: %v", obj, err)
+		}
+		// Return once the rollback is submitted instead of waiting for its outcome
+		rollbacker.(*DeploymentRollbacker).Async = true
+		result, err := rollbacker.Rollback(obj, nil, 1, false)
+		if err != nil {
+			t.Errorf("%T: unexpected error: %v", obj, err)
+			continue
+		}
+		if result != rollbackSubmitted {
+			t.Errorf("%T: expected result %q, got %q", obj, rollbackSubmitted, result)
+		}
+		submitted := false
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "create" && action.GetSubresource() == "rollback" {
+				submitted = true
+			}
+		}
+		if !submitted {
+			t.Errorf("%T: expected the rollback to be submitted, got %v", obj, client.Actions())
+		}
+	}
+}
+
+func TestDaemonSetRollbackMergePatch(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := fake.NewSimpleClientset(ds,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")))
+	var patch []byte
+	client.PrependReactor("patch", "daemonsets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patch = action.(clienttesting.PatchAction).GetPatch()
+		return true, nil, nil
+	})
+
+	rollbacker, err := RollbackerWithOptions(extensions.Kind("DaemonSet"), client, RollbackerOptions{PatchType: types.MergePatchType})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := rollbacker.Rollback(ds, map[string]string{"key": "value"}, 1, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(patch), "$patch") {
+		t.Errorf("expected a JSON merge patch, got %s", patch)
+	}
+	original, err := json.Marshal(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, err := jsonpatch.MergePatch(original, patch)
+	if err != nil {
+		t.Fatalf("unexpected error applying %s: %v", patch, err)
+	}
+	applied := &extensionsv1beta1.DaemonSet{}
+	if err := json.Unmarshal(patched, applied); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied.Spec.Template.Spec.Containers[0].Image; got != "foo:v1" {
+		t.Errorf("expected image %q, got %q", "foo:v1", got)
+	}
+	if got := applied.Annotations["key"]; got != "value" {
+		t.Errorf("expected the updated annotations to be recorded, got %v", applied.Annotations)
+	}
+
+	if _, err := RollbackerWithOptions(extensions.Kind("DaemonSet"), client, RollbackerOptions{PatchType: types.JSONPatchType}); err == nil {
+		t.Errorf("expected an error for an unsupported patch type")
+	}
+}
+
+func TestRollbackReplacedObject(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := newPatchingClientset(ds,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")))
+
+	// The DaemonSet was retrieved before it got deleted and recreated
+	stale := ds.DeepCopy()
+	stale.UID = "old-uid"
+	rollbacker := &DaemonSetRollbacker{c: client}
+	_, err := rollbacker.Rollback(stale, nil, 1, false)
+	if err == nil || !strings.Contains(err.Error(), "has been replaced") {
+		t.Errorf("expected an error about the replaced DaemonSet, got %v", err)
+	}
+	live, err := client.ExtensionsV1beta1().DaemonSets(ds.Namespace).Get(ds.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := live.Spec.Template.Spec.Containers[0].Image; got != "foo:v2" {
+		t.Errorf("expected the DaemonSet not to be rolled back, got image %q", got)
+	}
+
+	// Objects without a UID are not checked
+	unidentified := ds.DeepCopy()
+	unidentified.UID = ""
+	if _, err := rollbacker.Rollback(unidentified, nil, 1, false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRollbackForward(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := fake.NewSimpleClientset(ds,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")),
+		rollbackTestHistory(t, ds, gvk, 3, rollbackTestTemplate("foo:v3")))
+	client.PrependReactor("patch", "daemonsets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	rollbacker := &DaemonSetRollbacker{c: client, RollbackerOptions: RollbackerOptions{TemplatePrinter: &recordingTemplatePrinter{}}}
+
+	tests := []struct {
+		toRevision int64
+		dryRun     bool
+		expected   string
+	}{
+		{toRevision: 1, expected: rollbackSuccess},
+		{toRevision: 3, expected: rollforwardSuccess},
+		{toRevision: 1, dryRun: true, expected: "summary: revision 1 changes 1 container image\nwill roll back to template"},
+		{toRevision: 3, dryRun: true, expected: "summary: revision 3 changes 1 container image\nwill roll forward to template"},
+	}
+	for _, test := range tests {
+		result, err := rollbacker.Rollback(ds, nil, test.toRevision, test.dryRun)
+		if err != nil {
+			t.Errorf("revision %d: unexpected error: %v", test.toRevision, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("revision %d: expected %q, got %q", test.toRevision, test.expected, result)
+		}
+	}
+
+	current := rollbackTestReplicationController("foo-2", 2, "foo:v2")
+	rcClient := newPatchingClientset(
+		rollbackTestReplicationController("foo-1", 1, "foo:v1"),
+		current,
+		rollbackTestReplicationController("foo-3", 3, "foo:v3"),
+	)
+	rcRollbacker := &ReplicationControllerRollbacker{c: rcClient}
+	result, err := rcRollbacker.Rollback(current, nil, 3, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != rollforwardSuccess {
+		t.Errorf("expected %q, got %q", rollforwardSuccess, result)
+	}
+}
+
+func TestDeploymentRollbackDryRunRendersLiveDeployment(t *testing.T) {
+	deployment := rollbackTestDeployment("foo:v2")
+	client := fake.NewSimpleClientset(deployment,
+		rollbackTestReplicaSet(deployment, 1, "foo:v1"),
+		rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+
+	// Only the name of the passed deployment is used, its spec does not need to be converted
+	obj := &extensions.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault}}
+	printer := &recordingTemplatePrinter{}
+	rollbacker := &DeploymentRollbacker{c: client, RollbackerOptions: RollbackerOptions{TemplatePrinter: printer}}
+	result, err := rollbacker.Rollback(obj, nil, 1, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "summary: revision 1 changes 1 container image\ntemplate"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+	if len(printer.templates) != 1 || printer.templates[0].Spec.Containers[0].Image != "foo:v1" {
+		t.Errorf("expected the template of revision 1 to be printed, got %v", printer.templates)
+	}
+
+	obj.UID = "other-uid"
+	if _, err := rollbacker.Rollback(obj, nil, 1, true); err == nil {
+		t.Errorf("expected an error dry-running the rollback of a replaced deployment")
+	}
+}
+
+func TestRollbackAuditAnnotations(t *testing.T) {
+	checkAudit := func(name string, annotations map[string]string, from, to string) {
+		if annotations[RollbackFromRevisionAnnotation] != from || annotations[RollbackToRevisionAnnotation] != to {
+			t.Errorf("%s: expected a rollback from revision %q to %q, got %v", name, from, to, annotations)
+		}
+		if _, err := time.Parse(time.RFC3339, annotations[RollbackTimestampAnnotation]); err != nil {
+			t.Errorf("%s: expected an RFC 3339 timestamp, got %v", name, annotations)
+		}
+		if annotations["key"] != "value" {
+			t.Errorf("%s: expected the updated annotations to be kept, got %v", name, annotations)
+		}
+	}
+
+	deployment := rollbackTestDeployment("foo:v2")
+	deployment.Annotations = map[string]string{"deployment.kubernetes.io/revision": "2"}
+	internalDeployment := &extensions.Deployment{}
+	if err := legacyscheme.Scheme.Convert(deployment, internalDeployment, nil); err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewSimpleClientset(deployment, rollbackTestReplicaSet(deployment, 1, "foo:v1"), rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+	var deploymentRollback *extensionsv1beta1.DeploymentRollback
+	client.PrependReactor("create", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		deploymentRollback = action.(clienttesting.CreateAction).GetObject().(*extensionsv1beta1.DeploymentRollback)
+		return true, nil, nil
+	})
+	rollbacker := &DeploymentRollbacker{c: client, RollbackerOptions: RollbackerOptions{Async: true, AuditAnnotations: true}}
+	// The revision rolled back to is recorded even if the caller asks for the previous revision
+	if _, err := rollbacker.Rollback(internalDeployment, map[string]string{"key": "value"}, 0, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deploymentRollback == nil {
+		t.Fatalf("expected the rollback to be submitted")
+	}
+	checkAudit("deployment", deploymentRollback.UpdatedAnnotations, "2", "1")
+
+	ds := rollbackTestDaemonSet("foo:v3")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	dsClient := fake.NewSimpleClientset(ds,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")),
+		rollbackTestHistory(t, ds, gvk, 3, rollbackTestTemplate("foo:v3")))
+	var patch []byte
+	dsClient.PrependReactor("patch", "daemonsets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patch = action.(clienttesting.PatchAction).GetPatch()
+		return true, nil, nil
+	})
+	dsRollbacker := &DaemonSetRollbacker{c: dsClient, RollbackerOptions: RollbackerOptions{AuditAnnotations: true}}
+	if _, err := dsRollbacker.Rollback(ds, map[string]string{"key": "value"}, 1, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var patched struct {
+		Metadata metav1.ObjectMeta `json:"metadata"`
+	}
+	if err := json.Unmarshal(patch, &patched); err != nil {
+		t.Fatalf("unexpected error decoding %s: %v", patch, err)
+	}
+	checkAudit("daemonset", patched.Metadata.Annotations, "3", "1")
+
+	// Without the option no audit annotations are recorded
+	dsRollbacker.AuditAnnotations = false
+	if _, err := dsRollbacker.Rollback(ds, map[string]string{"key": "value"}, 1, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(patch), "rollback.kubernetes.io") {
+		t.Errorf("expected no audit annotations, got %s", patch)
+	}
+}
+
+func TestRollbackRequireChangeCause(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	objects := map[schema.GroupKind]runtime.Object{
+		extensions.Kind("Deployment"):     &extensions.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault}},
+		extensions.Kind("DaemonSet"):      ds,
+		apps.Kind("StatefulSet"):          &appsv1beta1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault}},
+		api.Kind("ReplicationController"): rollbackTestReplicationController("foo", 1, "foo:v1"),
+	}
+	expected := "refusing to roll back without a change-cause; set the kubernetes.io/change-cause annotation"
+	for kind, obj := range objects {
+		for _, dryRun := range []bool{false, true} {
+			client := fake.NewSimpleClientset()
+			rollbacker, err := RollbackerWithOptions(kind, client, RollbackerOptions{RequireChangeCause: true})
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", kind, err)
+			}
+			_, err = rollbacker.Rollback(obj, map[string]string{"key": "value"}, 1, dryRun)
+			if err == nil || err.Error() != expected {
+				t.Errorf("%s dryRun=%t: expected error %q, got %v", kind, dryRun, expected, err)
+			}
+			if actions := client.Actions(); len(actions) > 0 {
+				t.Errorf("%s dryRun=%t: expected no API calls, got %v", kind, dryRun, actions)
+			}
+		}
+	}
+
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := fake.NewSimpleClientset(ds,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")))
+	client.PrependReactor("patch", "daemonsets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	tests := []struct {
+		name        string
+		options     RollbackerOptions
+		annotations map[string]string
+		expected    string
+	}{
+		{name: "change-cause annotation", options: RollbackerOptions{RequireChangeCause: true}, annotations: map[string]string{ChangeCauseAnnotation: "revert bad image"}, expected: "revert bad image"},
+		{name: "change-cause source", options: RollbackerOptions{RequireChangeCause: true, ChangeCauseSource: "kubectl"}, expected: "rollback to revision 1 via kubectl"},
+		{name: "empty change-cause annotation", options: RollbackerOptions{RequireChangeCause: true, ChangeCauseSource: "kubectl"}, annotations: map[string]string{ChangeCauseAnnotation: ""}, expected: "rollback to revision 1 via kubectl"},
+	}
+	for _, test := range tests {
+		client.ClearActions()
+		rollbacker := &DaemonSetRollbacker{c: client, RollbackerOptions: test.options}
+		if _, err := rollbacker.Rollback(ds, test.annotations, 1, false); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		var changeCause string
+		for _, action := range client.Actions() {
+			if patch, ok := action.(clienttesting.PatchAction); ok {
+				var patched extensionsv1beta1.DaemonSet
+				if err := json.Unmarshal(patch.GetPatch(), &patched); err != nil {
+					t.Fatalf("%s: unexpected error decoding patch: %v", test.name, err)
+				}
+				changeCause = patched.Annotations[ChangeCauseAnnotation]
+			}
+		}
+		if changeCause != test.expected {
+			t.Errorf("%s: expected change-cause %q to be recorded, got %q", test.name, test.expected, changeCause)
+		}
+	}
+}
+
+func TestDaemonSetRollbackerWaitForRollout(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   extensionsv1beta1.DaemonSetStatus
+		expected string
+	}{
+		{
+			name: "rollout complete",
+			status: extensionsv1beta1.DaemonSetStatus{
+				ObservedGeneration:     2,
+				DesiredNumberScheduled: 3,
+				UpdatedNumberScheduled: 3,
+				NumberAvailable:        3,
+			},
+		},
+		{
+			name: "generation not observed",
+			status: extensionsv1beta1.DaemonSetStatus{
+				ObservedGeneration:     1,
+				DesiredNumberScheduled: 3,
+				UpdatedNumberScheduled: 3,
+				NumberAvailable:        3,
+			},
+			expected: `timed out waiting for DaemonSet "foo" rollback to complete: 3 of 3 nodes are still pending`,
+		},
+		{
+			name: "pods not updated",
+			status: extensionsv1beta1.DaemonSetStatus{
+				ObservedGeneration:     2,
+				DesiredNumberScheduled: 3,
+				UpdatedNumberScheduled: 1,
+				NumberAvailable:        3,
+			},
+			expected: `timed out waiting for DaemonSet "foo" rollback to complete: 2 of 3 nodes are still pending`,
+		},
+		{
+			name: "pods unavailable",
+			status: extensionsv1beta1.DaemonSetStatus{
+				ObservedGeneration:     2,
+				DesiredNumberScheduled: 3,
+				UpdatedNumberScheduled: 3,
+				NumberAvailable:        2,
+			},
+			expected: `timed out waiting for DaemonSet "foo" rollback to complete: 1 of 3 nodes are still pending`,
+		},
+	}
+	for _, test := range tests {
+		ds := &extensionsv1beta1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault, Generation: 2},
+			Status:     test.status,
+		}
+		rollbacker := &DaemonSetRollbacker{
+			c:                 fake.NewSimpleClientset(ds),
+			RollbackerOptions: RollbackerOptions{WaitForRollout: true, Timeout: 10 * time.Millisecond},
+		}
+		err := rollbacker.waitForRollout(ds.Namespace, ds.Name)
+		if len(test.expected) == 0 && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if len(test.expected) > 0 && (err == nil || err.Error() != test.expected) {
+			t.Errorf("%s: expected error %q, got %v", test.name, test.expected, err)
+		}
+	}
+
+	// DaemonSets updated only when their pods are deleted are not waited for
+	ds := rollbackTestDaemonSet("foo:v2")
+	ds.Generation = 2
+	ds.Spec.UpdateStrategy = extensionsv1beta1.DaemonSetUpdateStrategy{Type: extensionsv1beta1.OnDeleteDaemonSetStrategyType}
+	ds.Status = extensionsv1beta1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 3}
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := fake.NewSimpleClientset(ds,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")))
+	client.PrependReactor("patch", "daemonsets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	rollbacker := &DaemonSetRollbacker{c: client, RollbackerOptions: RollbackerOptions{WaitForRollout: true, Timeout: 10 * time.Millisecond}}
+	result, err := rollbacker.Rollback(ds, nil, 1, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != rollbackOnDelete {
+		t.Errorf("expected result %q, got %q", rollbackOnDelete, result)
+	}
+}
+
+func TestRollbackTypedErrors(t *testing.T) {
+	_, err := RollbackerFor(extensions.Kind("ReplicaSet"), fake.NewSimpleClientset())
+	if e, ok := err.(*UnsupportedKindError); !ok || e.Kind != extensions.Kind("ReplicaSet") {
+		t.Errorf("expected *UnsupportedKindError for ReplicaSet, got %#v", err)
+	}
+	if expected := fmt.Sprintf("no rollbacker has been implemented for %q", extensions.Kind("ReplicaSet")); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+
+	ds := rollbackTestDaemonSet("foo:v1")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := fake.NewSimpleClientset(ds, rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")))
+	rollbacker := &DaemonSetRollbacker{c: client}
+
+	// Rollbacks and history viewers report a missing revision the same way
+	_, rollbackErr := rollbacker.Rollback(ds, nil, 3, false)
+	_, viewErr := (&DaemonSetHistoryViewer{c: client}).ViewHistory(ds.Namespace, ds.Name, 3)
+	for _, err := range []error{rollbackErr, viewErr} {
+		if e, ok := err.(*RevisionNotFoundError); !ok || e.Revision != 3 || !reflect.DeepEqual(e.Available, []int64{1}) {
+			t.Errorf("expected *RevisionNotFoundError for revision 3 listing revision 1, got %#v", err)
+		}
+		if expected := "unable to find specified revision 3 in history (available revisions: 1)"; err == nil || err.Error() != expected {
+			t.Errorf("expected error %q, got %v", expected, err)
+		}
+	}
+
+	// The history is not looked at for negative revisions
+	_, err = rollbacker.Rollback(ds, nil, -1, false)
+	if expected := "unable to find specified revision -1 in history"; err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+
+	_, err = rollbacker.Rollback(ds, nil, 0, false)
+	if _, ok := err.(*NoHistoryError); !ok {
+		t.Errorf("expected *NoHistoryError, got %#v", err)
+	}
+	if expected := "no last revision to roll back to"; err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+
+	paused := &PausedError{Name: "foo"}
+	if expected := "you cannot rollback a paused deployment; resume it first with 'kubectl rollout resume deployment/foo' and try again"; paused.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, paused.Error())
+	}
+	notFound := &RevisionNotFoundError{Revision: 4, Available: []int64{1, 2}}
+	if expected := "unable to find specified revision 4 in history (available revisions: 1, 2)"; notFound.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, notFound.Error())
+	}
+}
+
+func TestRollbackDryRunManifest(t *testing.T) {
+	checkManifest := func(name, content, apiVersion, kind string) map[string]interface{} {
+		manifest := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(content), &manifest); err != nil {
+			t.Fatalf("%s: unexpected error parsing manifest %q: %v", name, content, err)
+		}
+		if manifest["apiVersion"] != apiVersion || manifest["kind"] != kind {
+			t.Errorf("%s: expected a %s %s manifest, got %v %v", name, apiVersion, kind, manifest["apiVersion"], manifest["kind"])
+		}
+		if _, ok := manifest["status"]; ok {
+			t.Errorf("%s: expected status to be removed, got %v", name, manifest["status"])
+		}
+		metadata, _ := manifest["metadata"].(map[string]interface{})
+		for _, field := range []string{"uid", "resourceVersion", "generation", "creationTimestamp"} {
+			if _, ok := metadata[field]; ok {
+				t.Errorf("%s: expected metadata.%s to be removed, got %v", name, field, metadata[field])
+			}
+		}
+		if metadata["name"] != "foo" {
+			t.Errorf("%s: expected metadata.name foo, got %v", name, metadata["name"])
+		}
+		return manifest
+	}
+
+	deployment := rollbackTestDeployment("foo:v2")
+	deployment.ResourceVersion = "7"
+	deployment.Generation = 2
+	deployment.Status.Replicas = 1
+	client := fake.NewSimpleClientset(deployment,
+		rollbackTestReplicaSet(deployment, 1, "foo:v1"),
+		rollbackTestReplicaSet(deployment, 2, "foo:v2"))
+	obj := &extensions.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: metav1.NamespaceDefault}}
+	rollbacker := &DeploymentRollbacker{c: client, RollbackerOptions: RollbackerOptions{DryRunManifest: true, ChangeCauseSource: "kubectl"}}
+	content, err := rollbacker.Rollback(obj, nil, 1, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkManifest("deployment", content, "extensions/v1beta1", "Deployment")
+	applied := &extensionsv1beta1.Deployment{}
+	if err := yaml.Unmarshal([]byte(content), applied); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if image := applied.Spec.Template.Spec.Containers[0].Image; image != "foo:v1" {
+		t.Errorf("deployment: expected image foo:v1, got %s", image)
+	}
+	if _, ok := applied.Spec.Template.Labels["pod-template-hash"]; ok {
+		t.Errorf("deployment: expected the pod-template-hash label to be removed, got %v", applied.Spec.Template.Labels)
+	}
+	if *applied.Spec.Replicas != 1 {
+		t.Errorf("deployment: expected the live spec to be kept, got %d replicas", *applied.Spec.Replicas)
+	}
+	if cause := applied.Annotations[ChangeCauseAnnotation]; cause != "rollback to revision 1 via kubectl" {
+		t.Errorf("deployment: expected the change-cause to be recorded, got %q", cause)
+	}
+
+	ds := rollbackTestDaemonSet("foo:v2")
+	ds.ResourceVersion = "3"
+	ds.Status = extensionsv1beta1.DaemonSetStatus{DesiredNumberScheduled: 3}
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client = fake.NewSimpleClientset(ds,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")))
+	dsRollbacker := &DaemonSetRollbacker{c: client, RollbackerOptions: RollbackerOptions{DryRunManifest: true, OutputFormat: "json"}}
+	content, err = dsRollbacker.Rollback(ds, nil, 1, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkManifest("daemonset", content, "extensions/v1beta1", "DaemonSet")
+	appliedDS := &extensionsv1beta1.DaemonSet{}
+	if err := yaml.Unmarshal([]byte(content), appliedDS); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if image := appliedDS.Spec.Template.Spec.Containers[0].Image; image != "foo:v1" {
+		t.Errorf("daemonset: expected image foo:v1, got %s", image)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("daemonset: expected no patch in a dry-run, got %v", action)
+		}
+	}
+}
+
+func TestRollbackChangeCauseAnnotationKey(t *testing.T) {
+	defer func(key string) { ChangeCauseAnnotationKey = key }(ChangeCauseAnnotationKey)
+	ChangeCauseAnnotationKey = "platform.example.com/release-note"
+
+	opts := RollbackerOptions{ChangeCauseSource: "kubectl"}
+	annotations := opts.withChangeCause(nil, 2)
+	if expected := map[string]string{ChangeCauseAnnotationKey: "rollback to revision 2 via kubectl"}; !reflect.DeepEqual(annotations, expected) {
+		t.Errorf("expected annotations %v, got %v", expected, annotations)
+	}
+	for _, given := range []map[string]string{
+		{ChangeCauseAnnotationKey: "release 2"},
+		{ChangeCauseAnnotation: "standard cause"},
+	} {
+		if annotations := opts.withChangeCause(given, 2); !reflect.DeepEqual(annotations, given) {
+			t.Errorf("expected the given change-cause %v to be kept, got %v", given, annotations)
+		}
+	}
+
+	opts = RollbackerOptions{RequireChangeCause: true}
+	if err := opts.checkChangeCause(map[string]string{ChangeCauseAnnotationKey: "release 2"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	expected := "refusing to roll back without a change-cause; set the platform.example.com/release-note annotation"
+	if err := opts.checkChangeCause(nil); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+// legacyRollbacker is a Rollbacker that does not implement OptionsRollbacker.
+type legacyRollbacker struct {
+	toRevision int64
+}
+
+func (r *legacyRollbacker) Rollback(obj runtime.Object, updatedAnnotations map[string]string, toRevision int64, dryRun bool) (string, error) {
+	r.toRevision = toRevision
+	return rollbackSuccess, nil
+}
+
+func TestRollbackWithOptions(t *testing.T) {
+	ds := rollbackTestDaemonSet("foo:v2")
+	gvk := extensionsv1beta1.SchemeGroupVersion.WithKind("DaemonSet")
+	client := newPatchingClientset(ds,
+		rollbackTestHistory(t, ds, gvk, 1, rollbackTestTemplate("foo:v1")),
+		rollbackTestHistory(t, ds, gvk, 2, rollbackTestTemplate("foo:v2")))
+	rollbacker, err := RollbackerFor(extensions.Kind("DaemonSet"), client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	optionsRollbacker, ok := rollbacker.(OptionsRollbacker)
+	if !ok {
+		t.Fatalf("expected %T to implement OptionsRollbacker", rollbacker)
+	}
+	result, err := optionsRollbacker.RollbackWithOptions(ds, RollbackOptions{UpdatedAnnotations: map[string]string{"key": "value"}, ToRevision: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != rollbackSuccess {
+		t.Errorf("expected result %q, got %q", rollbackSuccess, result)
+	}
+	rolledBack, err := client.ExtensionsV1beta1().DaemonSets(ds.Namespace).Get(ds.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image := rolledBack.Spec.Template.Spec.Containers[0].Image; image != "foo:v1" {
+		t.Errorf("expected image foo:v1, got %s", image)
+	}
+	if rolledBack.Annotations["key"] != "value" {
+		t.Errorf("expected updated annotations to be recorded, got %v", rolledBack.Annotations)
+	}
+
+	legacy := &legacyRollbacker{}
+	if _, err := rollbackWithOptions(legacy, ds, RollbackOptions{ToRevision: 3}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if legacy.toRevision != 3 {
+		t.Errorf("expected a Rollbacker without options to be rolled back to revision 3, got %d", legacy.toRevision)
+	}
+}